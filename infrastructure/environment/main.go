@@ -611,9 +611,20 @@ def lambda_handler(event, context):
 								credsBucketArn + "/*",
 							},
 						},
+						{
+							// Upload ledgers and refreshed youtube tokens are written back
+							Actions: []string{
+								"s3:PutObject",
+							},
+							Resources: []string{
+								credsBucketArn + "/*",
+							},
+						},
 						{
 							Actions: []string{
 								"kms:Decrypt",
+								"kms:Encrypt",
+								"kms:GenerateDataKey",
 							},
 							Resources: []string{
 								kmsKeyArn,
@@ -655,9 +666,20 @@ def lambda_handler(event, context):
 
 				executePolicyData, err := iam.GetPolicyDocument(ctx, &iam.GetPolicyDocumentArgs{
 					Statements: []iam.GetPolicyDocumentStatement{
+						{
+							// Upload ledgers and refreshed youtube tokens are written back
+							Actions: []string{
+								"s3:PutObject",
+							},
+							Resources: []string{
+								credsBucketArn + "/*",
+							},
+						},
 						{
 							Actions: []string{
 								"kms:Decrypt",
+								"kms:Encrypt",
+								"kms:GenerateDataKey",
 							},
 							Resources: []string{
 								kmsKeyArn,
@@ -6,6 +6,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/pashonic/arkstorm/src/providers/weatherbell"
+	"github.com/pashonic/arkstorm/src/publisher"
 	"github.com/pashonic/arkstorm/src/videobuilder"
 	"github.com/pashonic/arkstorm/src/videouploader"
 )
@@ -20,8 +21,23 @@ type config struct {
 	Providers struct {
 		Weatherbell weatherbell.Weatherbell
 	}
+	Build   videobuilder.Build
 	Videos  map[string]videobuilder.Video
 	Youtube videouploader.YoutubeVideos
+	Publish publisher.Publishing
+}
+
+// destinations returns where each video is published, videos without a
+// destination list go to YouTube when they have YouTube settings.
+func (conf *config) destinations() map[string][]string {
+	destinations := map[string][]string{}
+	for videoId := range conf.Youtube.Videos {
+		destinations[videoId] = []string{"youtube"}
+	}
+	for videoId, names := range conf.Publish.Destinations {
+		destinations[videoId] = names
+	}
+	return destinations
 }
 
 func main() {
@@ -48,16 +64,31 @@ func main() {
 	}
 
 	// Make videos from asset views
-	outputVideos, err := videobuilder.BuildVideos(conf.Videos, default_assets_dir, default_output_videos_dir)
+	buildResult, err := videobuilder.BuildVideos(conf.Videos, &conf.Build, default_assets_dir, default_output_videos_dir)
 	if err != nil {
 		log.Fatalln(err)
 		return
 	}
 
-	// Upload videos
-	err = videouploader.UploadVideos(&conf.Youtube, outputVideos)
-	if err != nil {
+	// Publish videos to their destinations
+	publishers := map[string]publisher.Publisher{}
+	for _, destination := range []publisher.Publisher{videouploader.NewPublisher(&conf.Youtube), publisher.NewArchive(&conf.Publish.Archive)} {
+		publishers[destination.Name()] = destination
+	}
+	results := publisher.PublishVideos(conf.destinations(), publishers, buildResult.Videos)
+
+	// Report published videos that need a look
+	if warned := publisher.Warned(results); len(warned) > 0 {
+		log.Printf("%v of %v publishes finished with warnings\n", len(warned), len(results))
+	}
+
+	// Fail the run when any video didn't build or publish
+	if err := buildResult.Err(); err != nil {
 		log.Fatalln(err)
 		return
 	}
+	if failed := publisher.Failed(results); len(failed) > 0 {
+		log.Fatalf("%v of %v publishes failed\n", len(failed), len(results))
+		return
+	}
 }
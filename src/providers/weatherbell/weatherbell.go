@@ -23,6 +23,7 @@ import (
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
 
+	"github.com/pashonic/arkstorm/src/utils/framemeta"
 	"github.com/pashonic/arkstorm/src/utils/restclient"
 )
 
@@ -105,6 +106,11 @@ func Download(weatherbell *Weatherbell, targetDir string) error {
 		if err := downloadFrameSet(imageList, view, filepath.Join(targetDir, viewName)); err != nil {
 			return err
 		}
+
+		// Record frame valid times for the video builder
+		if err := writeFrameSetMeta(imageList, selectedCycleTime, filepath.Join(targetDir, viewName)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -160,6 +166,21 @@ func downloadFrameSet(frameList []frame, view View, targetDir string) error {
 	return nil
 }
 
+func writeFrameSetMeta(frameList []frame, cycleTimeString string, targetDir string) error {
+	cycleNum, err := strconv.ParseInt(cycleTimeString, 10, 64)
+	if err != nil {
+		return err
+	}
+	frameSet := &framemeta.FrameSet{InitTime: time.Unix(cycleNum, 0).UTC()}
+	for index, frame := range frameList {
+		frameSet.Frames = append(frameSet.Frames, framemeta.Frame{
+			File:      fmt.Sprintf("%03d.png", index),
+			ValidTime: frame.timeStamp.UTC(),
+		})
+	}
+	return framemeta.Write(targetDir, frameSet)
+}
+
 func downloadFrame(index int, frame frame, view View, targetDir string) error {
 	// Send request
 	res, err := restclient.Get(frame.url)
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pashonic/arkstorm/src/utils/framemeta"
 	"github.com/pashonic/arkstorm/src/utils/mockclient"
 	"github.com/pashonic/arkstorm/src/utils/restclient"
 	"github.com/stretchr/testify/assert"
@@ -223,3 +224,30 @@ func TestDownloadFrameSet(t *testing.T) {
 	}
 
 }
+
+func TestWriteFrameSetMeta(t *testing.T) {
+
+	// Frames are written in download order with their png names
+	frameList := []frame{
+		{timeStamp: time.Unix(1675576800, 0)},
+		{timeStamp: time.Unix(1675587600, 0)},
+	}
+	targetDir := t.TempDir()
+	assert.Nil(t, writeFrameSetMeta(frameList, "1675555200", targetDir))
+	frameSet, err := framemeta.Read(targetDir)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(1675555200, 0).UTC(), frameSet.InitTime)
+	assert.Equal(t, []framemeta.Frame{
+		{File: "000.png", ValidTime: time.Unix(1675576800, 0).UTC()},
+		{File: "001.png", ValidTime: time.Unix(1675587600, 0).UTC()},
+	}, frameSet.Frames)
+	assert.Equal(t, 6, frameSet.ForecastHour(0))
+	assert.Equal(t, 9, frameSet.ForecastHour(1))
+
+	// Bad cycle times fail without writing metadata
+	targetDir = t.TempDir()
+	assert.NotNil(t, writeFrameSetMeta(frameList, "nope", targetDir))
+	frameSet, err = framemeta.Read(targetDir)
+	assert.Nil(t, err)
+	assert.Nil(t, frameSet)
+}
@@ -0,0 +1,121 @@
+package publisher
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pashonic/arkstorm/src/videobuilder"
+)
+
+const (
+	archive_destination = "archive"
+	archive_time_format = "20060102-150405"
+)
+
+type Archive struct {
+	Dir string // Folder runs are copied into, one folder per video and run
+}
+
+type archivePublisher struct {
+	config *Archive
+	now    func() time.Time
+}
+
+func NewArchive(config *Archive) Publisher {
+	return &archivePublisher{config: config, now: time.Now}
+}
+
+func (archive *archivePublisher) Name() string {
+	return archive_destination
+}
+
+// Publish copies every file the build produced into
+// <dir>/<video ID>/<run time>/.
+func (archive *archivePublisher) Publish(videoId string, video *videobuilder.OutputVideo) Result {
+	result := Result{Destination: archive_destination, VideoId: videoId, Status: StatusFailed}
+	if archive.config.Dir == "" {
+		result.Err = fmt.Errorf("archive dir isn't configured")
+		return result
+	}
+	runDir := filepath.Join(archive.config.Dir, videoId, archive.now().UTC().Format(archive_time_format))
+	if err := os.MkdirAll(runDir, os.ModePerm); err != nil {
+		result.Err = err
+		return result
+	}
+
+	// Collect files, HLS playlists bring their segment folder along
+	var filePaths []string
+	copiedDirs := map[string]bool{}
+	for _, outputFile := range video.Outputs {
+		if outputFile.Format != "hls" {
+			filePaths = append(filePaths, outputFile.FilePath)
+			continue
+		}
+		hlsDir := filepath.Dir(outputFile.FilePath)
+		if copiedDirs[hlsDir] {
+			continue
+		}
+		copiedDirs[hlsDir] = true
+		if err := copyDir(hlsDir, filepath.Join(runDir, filepath.Base(hlsDir))); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+	for _, subtitle := range video.Subtitles {
+		filePaths = append(filePaths, subtitle.FilePath)
+	}
+	if video.ThumbnailPath != "" {
+		filePaths = append(filePaths, video.ThumbnailPath)
+	}
+
+	// Copy files
+	for _, filePath := range filePaths {
+		if err := copyFile(filePath, filepath.Join(runDir, filepath.Base(filePath))); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+	result.Id = runDir
+	result.Url = "file://" + runDir
+	result.Status = StatusPublished
+	return result
+}
+
+func copyDir(sourceDir string, targetDir string) error {
+	if err := os.MkdirAll(targetDir, os.ModePerm); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(sourceDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err := copyFile(filepath.Join(sourceDir, entry.Name()), filepath.Join(targetDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(sourceFilePath string, targetFilePath string) error {
+	source, err := os.Open(sourceFilePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.Create(targetFilePath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
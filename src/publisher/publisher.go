@@ -0,0 +1,113 @@
+package publisher
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/pashonic/arkstorm/src/videobuilder"
+)
+
+const (
+	StatusPublished = "published"
+	StatusUnchanged = "unchanged" // Published by an earlier run of the same build
+	StatusFailed    = "failed"
+)
+
+// Publisher sends a rendered video to one destination.
+type Publisher interface {
+	Name() string
+	Publish(videoId string, video *videobuilder.OutputVideo) Result
+}
+
+type Result struct {
+	Destination string
+	VideoId     string
+	Id          string // Destination's ID for the published video
+	Url         string
+	Status      string
+	Err         error
+	Warnings    []error // Problems that didn't stop the video being published
+}
+
+type Publishing struct {
+	Archive      Archive
+	Destinations map[string][]string // Destination names, by video ID
+}
+
+// PublishVideos sends every video to each of its destinations. A failed
+// destination doesn't stop the others, every attempt is reported in the results.
+// Destinations that already have a video's build, going by its cache key,
+// are skipped so a rerun only retries what failed.
+func PublishVideos(destinations map[string][]string, publishers map[string]Publisher, videos map[string]videobuilder.OutputVideo) []Result {
+	var results []Result
+
+	// Publish in video ID order so runs are repeatable
+	var videoIds []string
+	for videoId := range destinations {
+		videoIds = append(videoIds, videoId)
+	}
+	sort.Strings(videoIds)
+
+	for _, videoId := range videoIds {
+		video, exists := videos[videoId]
+		state := readState(&video)
+		for _, name := range destinations[videoId] {
+			result := Result{Destination: name, VideoId: videoId, Status: StatusFailed}
+			publisher, found := publishers[name]
+			version, published := state.published(name)
+			switch {
+			case !exists:
+				result.Err = fmt.Errorf("video %q wasn't built", videoId)
+			case !found:
+				result.Err = fmt.Errorf("unknown destination %q", name)
+			case published:
+				result.Id, result.Url, result.Status = version.Id, version.Url, StatusUnchanged
+			default:
+				result = publisher.Publish(videoId, &video)
+				result.Destination, result.VideoId = name, videoId
+				if result.Err == nil {
+					if err := state.record(&video, &result); err != nil {
+						result.Warnings = append(result.Warnings, fmt.Errorf("recording publish state, a rerun will publish again: %w", err))
+					}
+				}
+			}
+			switch {
+			case result.Err != nil:
+				result.Status = StatusFailed
+				log.Printf("Publishing %v to %v failed: %v\n", videoId, name, result.Err)
+			case result.Status == StatusUnchanged:
+				log.Printf("Skipping %v to %v, this build was already published: %v\n", videoId, name, result.Url)
+			default:
+				log.Printf("Published %v to %v: %v\n", videoId, name, result.Url)
+			}
+			for _, warning := range result.Warnings {
+				log.Printf("Warning: publishing %v to %v: %v\n", videoId, name, warning)
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// Warned returns the published results that reported warnings.
+func Warned(results []Result) []Result {
+	var warned []Result
+	for _, result := range results {
+		if result.Status == StatusPublished && len(result.Warnings) > 0 {
+			warned = append(warned, result)
+		}
+	}
+	return warned
+}
+
+// Failed returns the results that didn't publish.
+func Failed(results []Result) []Result {
+	var failed []Result
+	for _, result := range results {
+		if result.Status == StatusFailed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
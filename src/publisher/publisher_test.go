@@ -0,0 +1,136 @@
+package publisher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pashonic/arkstorm/src/videobuilder"
+)
+
+type fakePublisher struct {
+	name      string
+	err       error
+	warnings  []error
+	published []string
+}
+
+func (fake *fakePublisher) Name() string {
+	return fake.name
+}
+
+func (fake *fakePublisher) Publish(videoId string, video *videobuilder.OutputVideo) Result {
+	fake.published = append(fake.published, videoId)
+	if fake.err != nil {
+		return Result{Status: StatusFailed, Err: fake.err}
+	}
+	return Result{Id: "remote-" + videoId, Url: "https://example.com/" + videoId, Status: StatusPublished, Warnings: fake.warnings}
+}
+
+func TestPublishVideos(t *testing.T) {
+	working := &fakePublisher{name: "working", warnings: []error{errors.New("no thumbnail")}}
+	broken := &fakePublisher{name: "broken", err: errors.New("quota exceeded")}
+	publishers := map[string]Publisher{"working": working, "broken": broken}
+	destinations := map[string][]string{
+		"winter": {"working", "broken"},
+		"summer": {"working", "missing"},
+		"spring": {"working"},
+	}
+	videos := map[string]videobuilder.OutputVideo{"winter": {}, "summer": {}}
+
+	results := PublishVideos(destinations, publishers, videos)
+	assert.Equal(t, 5, len(results))
+	assert.Equal(t, []string{"summer", "winter"}, working.published)
+
+	// A failing destination doesn't stop the others
+	failed := Failed(results)
+	assert.Equal(t, 3, len(failed))
+	assert.Contains(t, failed[0].Err.Error(), "wasn't built")
+	assert.Contains(t, failed[1].Err.Error(), "unknown destination")
+	assert.Equal(t, "broken", failed[2].Destination)
+	assert.Equal(t, "winter", failed[2].VideoId)
+	assert.Equal(t, "https://example.com/summer", results[1].Url)
+
+	// Warnings don't fail the publish
+	assert.Equal(t, 2, len(Warned(results)))
+}
+
+func TestPublishState(t *testing.T) {
+	tempDir := t.TempDir()
+	working := &fakePublisher{name: "working"}
+	broken := &fakePublisher{name: "broken", err: errors.New("quota exceeded")}
+	publishers := map[string]Publisher{"working": working, "broken": broken}
+	destinations := map[string][]string{"winter": {"working", "broken"}}
+	video := videobuilder.OutputVideo{FilePath: filepath.Join(tempDir, "Winter.mp4"), CacheKey: "first"}
+	publish := func() []Result {
+		return PublishVideos(destinations, publishers, map[string]videobuilder.OutputVideo{"winter": video})
+	}
+
+	// A rerun of the same build only retries the failed destination
+	assert.Equal(t, 1, len(Failed(publish())))
+	broken.err = nil
+	results := publish()
+	assert.Empty(t, Failed(results))
+	assert.Equal(t, StatusUnchanged, results[0].Status)
+	assert.Equal(t, "https://example.com/winter", results[0].Url)
+	assert.Equal(t, []string{"winter"}, working.published)
+	assert.Equal(t, []string{"winter", "winter"}, broken.published)
+	assert.FileExists(t, filepath.Join(tempDir, "Winter.publish.json"))
+
+	// Everything is published again once the build inputs change
+	video.CacheKey = "second"
+	publish()
+	assert.Equal(t, []string{"winter", "winter"}, working.published)
+	assert.Equal(t, 3, len(broken.published))
+
+	// Builds without a cache key can't be matched, so they always publish
+	video.CacheKey = ""
+	publish()
+	publish()
+	assert.Equal(t, 4, len(working.published))
+}
+
+func TestArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	videoDir := filepath.Join(tempDir, "videos")
+	hlsDir := filepath.Join(videoDir, "Winter-hls")
+	assert.Nil(t, os.MkdirAll(hlsDir, os.ModePerm))
+	for _, filePath := range []string{
+		filepath.Join(videoDir, "Winter.mp4"),
+		filepath.Join(videoDir, "Winter.srt"),
+		filepath.Join(videoDir, "Winter-thumbnail.jpg"),
+		filepath.Join(hlsDir, "720p.m3u8"),
+		filepath.Join(hlsDir, "720p_000.ts"),
+	} {
+		assert.Nil(t, os.WriteFile(filePath, []byte(filepath.Base(filePath)), 0644))
+	}
+	video := videobuilder.OutputVideo{
+		FilePath:      filepath.Join(videoDir, "Winter.mp4"),
+		Subtitles:     []videobuilder.OutputSubtitle{{Format: "srt", FilePath: filepath.Join(videoDir, "Winter.srt")}},
+		ThumbnailPath: filepath.Join(videoDir, "Winter-thumbnail.jpg"),
+		Outputs: []videobuilder.OutputFile{
+			{Name: "default", Format: "mp4", FilePath: filepath.Join(videoDir, "Winter.mp4")},
+			{Name: "720p", Format: "hls", FilePath: filepath.Join(hlsDir, "720p.m3u8")},
+		},
+	}
+
+	archive := NewArchive(&Archive{Dir: filepath.Join(tempDir, "archive")}).(*archivePublisher)
+	archive.now = func() time.Time { return time.Date(2023, 2, 3, 12, 30, 0, 0, time.UTC) }
+	result := archive.Publish("winter", &video)
+	assert.Nil(t, result.Err)
+	runDir := filepath.Join(tempDir, "archive", "winter", "20230203-123000")
+	assert.Equal(t, runDir, result.Id)
+	for _, fileName := range []string{"Winter.mp4", "Winter.srt", "Winter-thumbnail.jpg", "Winter-hls/720p.m3u8", "Winter-hls/720p_000.ts"} {
+		data, err := os.ReadFile(filepath.Join(runDir, fileName))
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Base(fileName), string(data))
+	}
+
+	// Archives need a folder
+	result = NewArchive(&Archive{}).Publish("winter", &video)
+	assert.Equal(t, StatusFailed, result.Status)
+}
@@ -0,0 +1,63 @@
+package publisher
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/pashonic/arkstorm/src/utils/filestore"
+	"github.com/pashonic/arkstorm/src/videobuilder"
+)
+
+// publishState records where a build was published, so a rerun with the
+// same build inputs only retries the destinations that failed.
+type publishState struct {
+	Key          string                      // Build cache key the results belong to
+	Destinations map[string]publishedVersion // By destination name
+}
+
+type publishedVersion struct {
+	Id  string
+	Url string
+}
+
+func stateFilePath(video *videobuilder.OutputVideo) string {
+	return strings.TrimSuffix(video.FilePath, filepath.Ext(video.FilePath)) + ".publish.json"
+}
+
+// readState returns the recorded destinations of the video's build, which is
+// empty when the inputs changed or nothing was recorded yet.
+func readState(video *videobuilder.OutputVideo) *publishState {
+	state := &publishState{Key: video.CacheKey, Destinations: map[string]publishedVersion{}}
+	if video.CacheKey == "" {
+		return state
+	}
+	data, err := filestore.Read(stateFilePath(video))
+	if err != nil {
+		return state
+	}
+	var recorded publishState
+	if err := json.Unmarshal(data, &recorded); err != nil || recorded.Key != video.CacheKey || recorded.Destinations == nil {
+		return state
+	}
+	return &recorded
+}
+
+func (state *publishState) published(destination string) (publishedVersion, bool) {
+	version, found := state.Destinations[destination]
+	return version, found
+}
+
+// record adds a published destination and saves the state, builds without
+// a cache key can't be matched on a rerun so they aren't recorded.
+func (state *publishState) record(video *videobuilder.OutputVideo, result *Result) error {
+	if state.Key == "" {
+		return nil
+	}
+	state.Destinations[result.Destination] = publishedVersion{Id: result.Id, Url: result.Url}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return filestore.Write(stateFilePath(video), data, 0644)
+}
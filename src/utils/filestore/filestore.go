@@ -0,0 +1,89 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const s3_prefix = "s3://"
+
+// IsS3 reports whether the path is an s3://bucket/key location.
+func IsS3(path string) bool {
+	return strings.HasPrefix(path, s3_prefix)
+}
+
+func splitS3(path string) (string, string, error) {
+	bucket, key, found := strings.Cut(strings.TrimPrefix(path, s3_prefix), "/")
+	if !found || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid s3 path %q, expected s3://bucket/key", path)
+	}
+	return bucket, key, nil
+}
+
+func newS3() *s3.S3 {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	return s3.New(sess)
+}
+
+// Read returns the contents of a local file or S3 object, missing files
+// return an error matching os.ErrNotExist.
+func Read(path string) ([]byte, error) {
+	if !IsS3(path) {
+		return os.ReadFile(path)
+	}
+	bucket, key, err := splitS3(path)
+	if err != nil {
+		return nil, err
+	}
+	output, err := newS3().GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, fmt.Errorf("%v: %w", path, os.ErrNotExist)
+		}
+		return nil, err
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+// Write replaces a local file or S3 object. Local files are written through
+// a temporary file so readers never see a partial write.
+func Write(path string, data []byte, perm os.FileMode) error {
+	if !IsS3(path) {
+		tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tempFile.Name())
+		if _, err := tempFile.Write(data); err != nil {
+			tempFile.Close()
+			return err
+		}
+		if err := tempFile.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(tempFile.Name(), perm); err != nil {
+			return err
+		}
+		return os.Rename(tempFile.Name(), path)
+	}
+	bucket, key, err := splitS3(path)
+	if err != nil {
+		return err
+	}
+	_, err = newS3().PutObject(&s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: bytes.NewReader(data)})
+	return err
+}
@@ -0,0 +1,56 @@
+package framemeta
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	FileName = "frames.json"
+)
+
+type Frame struct {
+	File      string
+	ValidTime time.Time
+}
+
+type FrameSet struct {
+	InitTime time.Time
+	Frames   []Frame
+}
+
+// ForecastHour returns the hours between the cycle init time and the valid
+// time of the frame at index.
+func (frameSet *FrameSet) ForecastHour(index int) int {
+	if index < 0 || index >= len(frameSet.Frames) {
+		return 0
+	}
+	return int(frameSet.Frames[index].ValidTime.Sub(frameSet.InitTime).Hours())
+}
+
+func Write(dir string, frameSet *FrameSet) error {
+	data, err := json.MarshalIndent(frameSet, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, FileName), data, 0644)
+}
+
+// Read loads the frame set stored in dir. A nil frame set is returned without
+// error when the directory has no metadata, e.g. assets from another source.
+func Read(dir string) (*FrameSet, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	frameSet := &FrameSet{}
+	if err := json.Unmarshal(data, frameSet); err != nil {
+		return nil, err
+	}
+	return frameSet, nil
+}
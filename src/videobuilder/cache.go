@@ -0,0 +1,146 @@
+package videobuilder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pashonic/arkstorm/src/utils/framemeta"
+)
+
+const (
+	cache_version = 3 // Bump when the rendering changes so old outputs are rebuilt
+)
+
+type buildCache struct {
+	Key   string
+	Video OutputVideo
+}
+
+func cacheFilePath(outputDir string, video *Video) string {
+	return filepath.Join(outputDir, video.Filename+".cache.json")
+}
+
+// cacheKey hashes everything an encode depends on, the source frames and
+// frame metadata of every clip, the video settings with defaults resolved
+// and the fonts and logo they reference.
+func cacheKey(video *Video, plans []clipPlan) (string, error) {
+	hasher := sha256.New()
+
+	// Settings
+	settings := struct {
+		Version   int
+		Video     *Video
+		FrameRate int
+		Encoder   encoder
+	}{cache_version, video, video.frameRate(), video.encoder()}
+	settingsData, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	hasher.Write(settingsData)
+
+	// Referenced files, replacing one keeps its path in the settings
+	for _, filePath := range video.referencedFiles() {
+		fmt.Fprintf(hasher, "%v\n", filePath)
+		if err := hashFile(hasher, filePath); err != nil {
+			return "", err
+		}
+	}
+
+	// Source frames
+	for _, plan := range plans {
+		fileList, err := ioutil.ReadDir(plan.sourceDir)
+		if err != nil {
+			return "", err
+		}
+		for _, file := range fileList {
+			if file.IsDir() || (filepath.Ext(file.Name()) != ".png" && file.Name() != framemeta.FileName) {
+				continue
+			}
+			fmt.Fprintf(hasher, "%v/%v\n", plan.clip.View, file.Name())
+			if err := hashFile(hasher, filepath.Join(plan.sourceDir, file.Name())); err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// referencedFiles returns the font files of every text and the thumbnail logo.
+func (video *Video) referencedFiles() []string {
+	var filePaths []string
+	seen := map[string]bool{}
+	for _, text := range video.allTexts() {
+		if text.Fontfile != "" && !seen[text.Fontfile] {
+			seen[text.Fontfile] = true
+			filePaths = append(filePaths, text.Fontfile)
+		}
+	}
+	if video.Thumbnail != nil && video.Thumbnail.Logo != "" {
+		filePaths = append(filePaths, video.Thumbnail.Logo)
+	}
+	return filePaths
+}
+
+func hashFile(hasher hash.Hash, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(hasher, file)
+	return err
+}
+
+// readCache returns the cached build when its key matches and every file it
+// produced still exists.
+func readCache(filePath string, key string) (*OutputVideo, bool) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, false
+	}
+	var cache buildCache
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Key != key {
+		return nil, false
+	}
+	filePaths := []string{cache.Video.FilePath}
+	for _, outputFile := range cache.Video.Outputs {
+		filePaths = append(filePaths, outputFile.FilePath)
+	}
+	for _, subtitle := range cache.Video.Subtitles {
+		filePaths = append(filePaths, subtitle.FilePath)
+	}
+	if cache.Video.ThumbnailPath != "" {
+		filePaths = append(filePaths, cache.Video.ThumbnailPath)
+	}
+	for _, path := range filePaths {
+		if _, err := os.Stat(path); err != nil {
+			return nil, false
+		}
+	}
+	return &cache.Video, true
+}
+
+// writeCache records a finished build, written through a temporary file so
+// an interrupted run never leaves a partial cache behind.
+func writeCache(filePath string, outputVideo *OutputVideo) error {
+	cache := buildCache{Key: outputVideo.CacheKey, Video: *outputVideo}
+	cache.Video.CacheHit = false
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempFilePath := strings.TrimSuffix(filePath, ".json") + ".tmp"
+	if err := os.WriteFile(tempFilePath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFilePath, filePath)
+}
@@ -0,0 +1,57 @@
+package videobuilder
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func formatChapterMetadata(clips []OutputClip) string {
+	var builder strings.Builder
+	builder.WriteString(";FFMETADATA1\n")
+	for _, clip := range clips {
+		builder.WriteString("[CHAPTER]\nTIMEBASE=1/1000\n")
+		fmt.Fprintf(&builder, "START=%d\n", int64(clip.StartTimeSec*1000+0.5))
+		fmt.Fprintf(&builder, "END=%d\n", int64((clip.StartTimeSec+clip.DurationSec)*1000+0.5))
+		fmt.Fprintf(&builder, "title=%v\n", escapeMetadata(clip.Name))
+	}
+	return builder.String()
+}
+
+// escapeMetadata escapes the characters the ffmetadata format treats as syntax.
+func escapeMetadata(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "=", "\\=", ";", "\\;", "#", "\\#", "\n", "\\\n")
+	return replacer.Replace(value)
+}
+
+// embedMetadata remuxes the encoded video with an ffmetadata chapter input
+// and the subtitle file as a soft mov_text track. ffmpeg-go only adds inputs
+// that feed a mapped stream, and a metadata file has no streams, so these
+// arguments are put together by hand.
+func embedMetadata(videoFilePath string, clips []OutputClip, subtitleFilePath string, language string) error {
+	basePath := strings.TrimSuffix(videoFilePath, ".mp4")
+	metadataFilePath := basePath + ".ffmetadata"
+	remuxFilePath := basePath + ".remux.mp4"
+	if err := os.WriteFile(metadataFilePath, []byte(formatChapterMetadata(clips)), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(metadataFilePath)
+
+	args := []string{
+		"-i", videoFilePath,
+		"-f", "ffmetadata", "-i", metadataFilePath,
+		"-i", subtitleFilePath,
+		"-map", "0:v",
+		"-map", "2",
+		"-map_metadata", "1",
+		"-map_chapters", "1",
+		"-c", "copy",
+		"-c:s", "mov_text",
+		"-metadata:s:s:0", "language=" + language,
+		"-y", remuxFilePath,
+	}
+	if err := FfmpegRunner.Run(args, nil); err != nil {
+		return fmt.Errorf("metadata remux failed: %w", err)
+	}
+	return os.Rename(remuxFilePath, videoFilePath)
+}
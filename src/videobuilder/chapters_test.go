@@ -0,0 +1,18 @@
+package videobuilder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatChapterMetadata(t *testing.T) {
+	clips := []OutputClip{
+		{Name: "Snow; 24h", StartTimeSec: 0, DurationSec: 1.44},
+		{Name: "Temp=2m", StartTimeSec: 1.44, DurationSec: 10},
+	}
+	expected := ";FFMETADATA1\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=1440\ntitle=Snow\\; 24h\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=1440\nEND=11440\ntitle=Temp\\=2m\n"
+	assert.Equal(t, expected, formatChapterMetadata(clips))
+}
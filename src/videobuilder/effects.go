@@ -0,0 +1,176 @@
+package videobuilder
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	interpolate_motion = "motion"
+	interpolate_blend  = "blend"
+	default_zoom_from  = 1.0
+	default_zoom_to    = 1.2
+	default_zoom_focus = 0.5
+)
+
+type zoom struct {
+	From float64  // Zoom factor at the start of the clip
+	To   float64  // Zoom factor at the end of the clip
+	X    *float64 // Focus point across the image, 0 is the left edge and 1 the right edge
+	Y    *float64 // Focus point down the image, 0 is the top edge and 1 the bottom edge
+}
+
+type interpolate struct {
+	Mode string // motion estimates movement between images, blend crossfades them
+	Fps  int    // Interpolated frame rate, defaults to the video frame rate
+}
+
+type resolvedZoom struct {
+	from, to, x, y float64
+}
+
+func (zoom *zoom) resolve() resolvedZoom {
+	resolved := resolvedZoom{from: zoom.From, to: zoom.To, x: default_zoom_focus, y: default_zoom_focus}
+	if resolved.from == 0 {
+		resolved.from = default_zoom_from
+	}
+	if resolved.to == 0 {
+		resolved.to = default_zoom_to
+	}
+	if zoom.X != nil {
+		resolved.x = *zoom.X
+	}
+	if zoom.Y != nil {
+		resolved.y = *zoom.Y
+	}
+	return resolved
+}
+
+// holdFrames returns how many output frames the last image is held for.
+func (clip *clip) holdFrames(frameRate int) int {
+	return int(math.Round(clip.Hold * float64(frameRate)))
+}
+
+// sequence returns the source image shown for each step of speed frames.
+// Bounce clips play forward, then back to the first image.
+func (clip *clip) sequence(fileCount int, frameCount int) []int {
+	var frames []int
+	if clip.Time > 0 {
+		for index := 0; index < frameCount/clip.speed(); index++ {
+			frames = append(frames, index%fileCount)
+		}
+		return frames
+	}
+	for frame := 0; frame < fileCount; frame++ {
+		frames = append(frames, frame)
+	}
+	if clip.Bounce {
+		for frame := fileCount - 2; frame >= 0; frame-- {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+func (clip *clip) validateEffects() error {
+	if clip.Zoom != nil {
+		if clip.Time == 0 {
+			return fmt.Errorf("clip %q: zoom only applies to static clips with a time", clip.Name)
+		}
+		zoom := clip.Zoom.resolve()
+		if zoom.from < 1 || zoom.to < 1 {
+			return fmt.Errorf("clip %q: zoom factors must be at least 1", clip.Name)
+		}
+		if zoom.x < 0 || zoom.x > 1 || zoom.y < 0 || zoom.y > 1 {
+			return fmt.Errorf("clip %q: zoom focus must be between 0 and 1", clip.Name)
+		}
+	}
+	if clip.Time > 0 && (clip.Hold > 0 || clip.Bounce) {
+		return fmt.Errorf("clip %q: hold and bounce only apply to animated clips", clip.Name)
+	}
+	if mode := clip.Interpolate.Mode; mode != "" {
+		if mode != interpolate_motion && mode != interpolate_blend {
+			return fmt.Errorf("clip %q: unsupported interpolation mode %q", clip.Name, mode)
+		}
+		if clip.Time > 0 {
+			return fmt.Errorf("clip %q: interpolation only applies to animated clips", clip.Name)
+		}
+		if clip.Interpolate.Fps < 0 {
+			return fmt.Errorf("clip %q: interpolation fps can't be negative", clip.Name)
+		}
+	}
+	if clip.Hold < 0 {
+		return fmt.Errorf("clip %q: hold can't be negative", clip.Name)
+	}
+	return nil
+}
+
+// clipPlayback builds the clip's source stream with its playback effects
+// applied, the result runs for the plan's frame count.
+func clipPlayback(plan *clipPlan, frameRate int) *ffmpeg.Stream {
+	clip := plan.clip
+	sourcePath := filepath.Join(plan.sourceDir, "%03d.png")
+
+	// Set loop identifer, static frame segments are looped for the clip time
+	inputArgs := ffmpeg.KwArgs{"framerate": frameRate, "loop": "0"}
+	if clip.Time > 0 {
+		inputArgs["loop"] = "1"
+		inputArgs["t"] = clip.Time
+	}
+	stream := ffmpeg.Input(sourcePath, inputArgs)
+
+	// Zoom emits speed frames per source frame, so it replaces the speed setting
+	if clip.Zoom != nil {
+		zoom := clip.Zoom.resolve()
+		zoomArgs := ffmpeg.KwArgs{
+			"z":   fmt.Sprintf("%.4g+(%.4g)*on/%v", zoom.from, zoom.to-zoom.from, plan.frameCount),
+			"x":   fmt.Sprintf("(iw-iw/zoom)*%.4g", zoom.x),
+			"y":   fmt.Sprintf("(ih-ih/zoom)*%.4g", zoom.y),
+			"d":   clip.speed(),
+			"s":   fmt.Sprintf("%vx%v", plan.width, plan.height),
+			"fps": frameRate,
+		}
+		return stream.Filter("zoompan", nil, zoomArgs)
+	}
+
+	// Process speed settings
+	stream = stream.Filter("setpts", ffmpeg.Args{fmt.Sprintf("%v*PTS", clip.speed())})
+
+	// Play back to the first image, skipping the repeated last image
+	if clip.Bounce && plan.fileCount > 1 {
+		split := stream.Split()
+		reverse := split.Get("1").Filter("reverse", nil).
+			Filter("trim", nil, ffmpeg.KwArgs{"start_frame": 1}).
+			Filter("setpts", ffmpeg.Args{"PTS-STARTPTS"})
+		stream = ffmpeg.Concat([]*ffmpeg.Stream{split.Get("0"), reverse})
+	}
+
+	// Hold the last image. Clones are spaced one output frame apart from the
+	// last image's timestamp, so it needs speed-1 more to keep its own duration.
+	// Interpolated clips always pad, since interpolation stops at the last
+	// timestamp and would otherwise cut the last image short
+	holdFrames := clip.holdFrames(frameRate)
+	if holdFrames > 0 || clip.Interpolate.Mode != "" {
+		if padFrames := holdFrames + clip.speed() - 1; padFrames > 0 {
+			stream = stream.Filter("tpad", nil, ffmpeg.KwArgs{"stop_mode": "clone", "stop": padFrames})
+		}
+	}
+
+	// Fill in frames between images, the interpolation filters need YUV input
+	if clip.Interpolate.Mode != "" {
+		fps := clip.Interpolate.Fps
+		if fps == 0 {
+			fps = frameRate
+		}
+		stream = stream.Filter("format", nil, ffmpeg.KwArgs{"pix_fmts": "yuv444p"})
+		if clip.Interpolate.Mode == interpolate_motion {
+			stream = stream.Filter("minterpolate", nil, ffmpeg.KwArgs{"fps": fps, "mi_mode": "mci", "mc_mode": "aobmc", "me_mode": "bidir"})
+		} else {
+			stream = stream.Filter("framerate", nil, ffmpeg.KwArgs{"fps": fps})
+		}
+	}
+	return stream
+}
@@ -0,0 +1,187 @@
+package videobuilder
+
+import (
+	"fmt"
+	"regexp"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	default_encoder_codec     = "libx264"
+	default_encoder_preset    = "medium"
+	default_encoder_pixfmt    = "yuv420p"
+	default_encoder_profile   = "high"
+	default_keyframe_interval = 2 // Seconds between keyframes
+)
+
+type codecLimits struct {
+	defaultCrf int
+	maxCrf     int
+	presets    []string
+	profiles   []string
+}
+
+var x26x_presets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo"}
+
+// Codecs the encoder settings can be validated against
+var encoder_codecs = map[string]codecLimits{
+	"libx264":    {defaultCrf: 20, maxCrf: 51, presets: x26x_presets, profiles: []string{"baseline", "main", "high", "high10", "high422", "high444"}},
+	"libx265":    {defaultCrf: 24, maxCrf: 51, presets: x26x_presets, profiles: []string{"main", "main10", "main12", "main422-10", "main444-8"}},
+	"libvpx-vp9": {defaultCrf: 32, maxCrf: 63, profiles: []string{"0", "1", "2", "3"}},
+}
+
+var encoder_pixfmts = []string{"yuv420p", "yuvj420p", "yuv422p", "yuv444p", "yuv420p10le"}
+
+// Pixel formats each H.264 profile can carry
+var x264_profile_pixfmts = map[string][]string{
+	"baseline": {"yuv420p", "yuvj420p"},
+	"main":     {"yuv420p", "yuvj420p"},
+	"high":     {"yuv420p", "yuvj420p"},
+	"high10":   {"yuv420p", "yuvj420p", "yuv420p10le"},
+	"high422":  {"yuv420p", "yuvj420p", "yuv420p10le", "yuv422p"},
+	"high444":  encoder_pixfmts,
+}
+
+var level_regex = regexp.MustCompile(`^\d(\.\d)?$`)
+
+type encoder struct {
+	Codec     string
+	Crf       *int // Constant quality, 0 is lossless for libx264
+	Bitrate   string
+	Preset    string
+	Pixfmt    string
+	Keyframes int // Frames between keyframes
+	Profile   string
+	Level     string
+}
+
+// resolve fills in defaults, profile and preset only default for the
+// default codec since their values are codec specific.
+func (encoder encoder) resolve(frameRate int) encoder {
+	if encoder.Codec == "" {
+		encoder.Codec = default_encoder_codec
+	}
+	if encoder.Crf == nil && encoder.Bitrate == "" {
+		crf := encoder_codecs[encoder.Codec].defaultCrf
+		encoder.Crf = &crf
+	}
+	if encoder.Pixfmt == "" {
+		encoder.Pixfmt = default_encoder_pixfmt
+	}
+	if encoder.Keyframes == 0 {
+		encoder.Keyframes = frameRate * default_keyframe_interval
+	}
+	if encoder.Codec == default_encoder_codec {
+		if encoder.Preset == "" {
+			encoder.Preset = default_encoder_preset
+		}
+		if encoder.Profile == "" && contains(x264_profile_pixfmts[default_encoder_profile], encoder.Pixfmt) && !encoder.lossless() {
+			encoder.Profile = default_encoder_profile
+		}
+	}
+	return encoder
+}
+
+// lossless reports whether libx264 is set to crf 0, which only the high444
+// profile can carry.
+func (encoder *encoder) lossless() bool {
+	return encoder.Codec == "libx264" && encoder.Crf != nil && *encoder.Crf == 0
+}
+
+func (video *Video) encoder() encoder {
+	return video.Encoder.resolve(video.frameRate())
+}
+
+// outputEncoder returns the settings for a declared output. Outputs using
+// another codec than the video only carry over the codec independent settings.
+func (video *Video) outputEncoder(output *output) encoder {
+	base := video.Encoder
+	if base.Codec == "" {
+		base.Codec = default_encoder_codec
+	}
+	outputEncoder := base
+	if codec := output.codec(base.Codec); codec != base.Codec {
+		outputEncoder = encoder{Codec: codec, Pixfmt: base.Pixfmt, Keyframes: base.Keyframes}
+	}
+	if output.Bitrate != "" {
+		outputEncoder.Bitrate = output.Bitrate
+		outputEncoder.Crf = nil
+	}
+	return outputEncoder.resolve(video.frameRate())
+}
+
+func (encoder *encoder) validate() error {
+	limits, exists := encoder_codecs[encoder.Codec]
+	if !exists {
+		return fmt.Errorf("encoder: unsupported codec %q", encoder.Codec)
+	}
+	if encoder.Crf != nil && encoder.Bitrate != "" {
+		return fmt.Errorf("encoder: crf and bitrate can't both be set")
+	}
+	if encoder.Crf != nil && (*encoder.Crf < 0 || *encoder.Crf > limits.maxCrf) {
+		return fmt.Errorf("encoder: crf %v is outside 0-%v for %v", *encoder.Crf, limits.maxCrf, encoder.Codec)
+	}
+	if encoder.Bitrate != "" {
+		if _, err := parseBitrate(encoder.Bitrate); err != nil {
+			return fmt.Errorf("encoder: %w", err)
+		}
+	}
+	if encoder.Preset != "" && !contains(limits.presets, encoder.Preset) {
+		return fmt.Errorf("encoder: unsupported preset %q for %v", encoder.Preset, encoder.Codec)
+	}
+	if encoder.Profile != "" && !contains(limits.profiles, encoder.Profile) {
+		return fmt.Errorf("encoder: unsupported profile %q for %v", encoder.Profile, encoder.Codec)
+	}
+	if encoder.Level != "" && !level_regex.MatchString(encoder.Level) {
+		return fmt.Errorf("encoder: invalid level %q", encoder.Level)
+	}
+	if !contains(encoder_pixfmts, encoder.Pixfmt) {
+		return fmt.Errorf("encoder: unsupported pixel format %q", encoder.Pixfmt)
+	}
+	if encoder.Codec == "libx264" && encoder.Profile != "" && !contains(x264_profile_pixfmts[encoder.Profile], encoder.Pixfmt) {
+		return fmt.Errorf("encoder: profile %q can't encode pixel format %q", encoder.Profile, encoder.Pixfmt)
+	}
+	if encoder.lossless() && encoder.Profile != "" && encoder.Profile != "high444" {
+		return fmt.Errorf("encoder: lossless crf 0 needs the high444 profile, not %q", encoder.Profile)
+	}
+	if encoder.Keyframes < 0 {
+		return fmt.Errorf("encoder: keyframe interval can't be negative")
+	}
+	return nil
+}
+
+func (encoder *encoder) outputArgs() ffmpeg.KwArgs {
+	args := ffmpeg.KwArgs{
+		"c:v":     encoder.Codec,
+		"pix_fmt": encoder.Pixfmt,
+		"g":       encoder.Keyframes,
+	}
+	if encoder.Bitrate != "" {
+		args["b:v"] = encoder.Bitrate
+	} else if encoder.Crf != nil {
+		args["crf"] = *encoder.Crf
+		if encoder.Codec == "libvpx-vp9" { // Constant quality mode needs a zero bitrate
+			args["b:v"] = "0"
+		}
+	}
+	if encoder.Preset != "" {
+		args["preset"] = encoder.Preset
+	}
+	if encoder.Profile != "" {
+		args["profile:v"] = encoder.Profile
+	}
+	if encoder.Level != "" {
+		args["level:v"] = encoder.Level
+	}
+	return args
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
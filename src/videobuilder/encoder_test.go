@@ -0,0 +1,61 @@
+package videobuilder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func crf(value int) *int {
+	return &value
+}
+
+func TestValidateEncoder(t *testing.T) {
+	valid := encoder{}.resolve(25)
+	assert.Nil(t, valid.validate())
+
+	invalid := []encoder{
+		{Codec: "mpeg2video"},
+		{Crf: crf(60)},
+		{Crf: crf(20), Bitrate: "3M"},
+		{Preset: "warp"},
+		{Pixfmt: "rgb24"},
+		{Pixfmt: "yuv444p", Profile: "high"},
+		{Level: "four"},
+		{Crf: crf(0), Profile: "high"},
+	}
+	for _, settings := range invalid {
+		resolved := settings.resolve(25)
+		assert.NotNil(t, resolved.validate(), "%+v", settings)
+	}
+}
+
+func TestEncoderOutputArgs(t *testing.T) {
+
+	// Defaults encode yuv420p H.264 with a keyframe every two seconds
+	resolved := encoder{}.resolve(25)
+	expected := ffmpeg.KwArgs{"c:v": "libx264", "pix_fmt": "yuv420p", "g": 50, "crf": 20, "preset": "medium", "profile:v": "high"}
+	assert.Equal(t, expected, resolved.outputArgs())
+
+	// Profiles aren't guessed for pixel formats the default one can't carry
+	resolved = encoder{Pixfmt: "yuv444p"}.resolve(30)
+	assert.Equal(t, "", resolved.Profile)
+	assert.Equal(t, 60, resolved.Keyframes)
+
+	// Other codecs only carry over the codec independent settings
+	video := Video{Encoder: encoder{Crf: crf(18), Preset: "slow", Pixfmt: "yuv420p", Keyframes: 48}}
+	webm := video.outputEncoder(&output{Format: "webm"})
+	expected = ffmpeg.KwArgs{"c:v": "libvpx-vp9", "pix_fmt": "yuv420p", "g": 48, "crf": 32, "b:v": "0"}
+	assert.Equal(t, expected, webm.outputArgs())
+	hls := video.outputEncoder(&output{Format: "hls", Bitrate: "3M"})
+	assert.Equal(t, "3M", hls.outputArgs()["b:v"])
+	assert.Nil(t, hls.outputArgs()["crf"])
+	assert.Equal(t, "slow", hls.Preset)
+
+	// Crf 0 is kept as lossless rather than replaced by the default
+	lossless := encoder{Crf: crf(0)}.resolve(25)
+	assert.Nil(t, lossless.validate())
+	assert.Equal(t, 0, lossless.outputArgs()["crf"])
+	assert.Nil(t, lossless.outputArgs()["profile:v"])
+}
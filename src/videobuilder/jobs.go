@@ -0,0 +1,106 @@
+package videobuilder
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	default_job_memory_bytes = 1536 * 1024 * 1024 // Rough peak for one 1080p encode with its filter graph
+	meminfo_file             = "/proc/meminfo"
+	cgroup_memory_max_file   = "/sys/fs/cgroup/memory.max"
+	cgroup_v1_memory_file    = "/sys/fs/cgroup/memory/memory.limit_in_bytes"
+	cgroup_cpu_max_file      = "/sys/fs/cgroup/cpu.max"
+)
+
+type Build struct {
+	Jobs int // Videos built at once, derived from CPUs and memory when zero
+}
+
+// jobLimit returns how many videos can be built at once. One job runs per
+// CPU, fewer when there isn't enough memory for that many encodes.
+func (build *Build) jobLimit() int {
+	if build != nil && build.Jobs > 0 {
+		return build.Jobs
+	}
+	jobs := availableCpus()
+	if memory := availableMemory(); memory > 0 {
+		if memoryJobs := int(memory / default_job_memory_bytes); memoryJobs < jobs {
+			jobs = memoryJobs
+		}
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	return jobs
+}
+
+// availableCpus returns the CPU count, limited by a cgroup CPU quota as set
+// on containers such as Fargate tasks.
+func availableCpus() int {
+	cpus := runtime.NumCPU()
+	data, err := os.ReadFile(cgroup_cpu_max_file)
+	if err != nil {
+		return cpus
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] == "max" {
+		return cpus
+	}
+	quota, quotaErr := strconv.ParseFloat(fields[0], 64)
+	period, periodErr := strconv.ParseFloat(fields[1], 64)
+	if quotaErr != nil || periodErr != nil || period <= 0 {
+		return cpus
+	}
+	if quotaCpus := int(quota / period); quotaCpus < cpus {
+		cpus = quotaCpus
+	}
+	if cpus < 1 {
+		cpus = 1
+	}
+	return cpus
+}
+
+// availableMemory returns the available memory in bytes, limited by a cgroup
+// memory limit. Zero means unknown.
+func availableMemory() uint64 {
+	memory := meminfoAvailable()
+	for _, filePath := range []string{cgroup_memory_max_file, cgroup_v1_memory_file} {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil { // Unlimited cgroups report "max"
+			continue
+		}
+		if memory == 0 || limit < memory {
+			memory = limit
+		}
+		break
+	}
+	return memory
+}
+
+func meminfoAvailable() uint64 {
+	file, err := os.Open(meminfo_file)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kilobytes, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kilobytes * 1024
+		}
+	}
+	return 0
+}
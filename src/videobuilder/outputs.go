@@ -0,0 +1,212 @@
+package videobuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	default_output_name     = "default"
+	default_hls_master_name = "hls_master"
+	default_hls_segment_sec = 6
+)
+
+var output_formats = []string{"mp4", "webm", "gif", "hls"}
+
+type output struct {
+	Name     string
+	Format   string
+	Codec    string
+	Scale    string
+	Bitrate  string
+	Vertical bool
+}
+
+type hlsRendition struct {
+	filePath  string
+	bandwidth int
+}
+
+func (output *output) name() string {
+	if output.Name != "" {
+		return output.Name
+	}
+	return output.Format
+}
+
+// codec returns the output codec, MP4 and HLS outputs follow the video codec
+// unless one is set.
+func (output *output) codec(videoCodec string) string {
+	if output.Codec != "" {
+		return output.Codec
+	}
+	if output.Format == "webm" && videoCodec != "libvpx-vp9" {
+		return "libvpx-vp9"
+	}
+	return videoCodec
+}
+
+func (video *Video) validateOutputs() error {
+	names := map[string]bool{default_output_name: true, default_hls_master_name: true}
+	for _, output := range video.Outputs {
+		if !contains(output_formats, output.Format) {
+			return fmt.Errorf("output %q: unsupported format %q", output.name(), output.Format)
+		}
+		if names[output.name()] {
+			return fmt.Errorf("output %q: name is already used", output.name())
+		}
+		names[output.name()] = true
+		if output.Format == "hls" && output.Bitrate == "" {
+			return fmt.Errorf("output %q: hls renditions need a bitrate", output.name())
+		}
+		if output.Vertical && video.Timeline != nil {
+			return fmt.Errorf("output %q: the timeline spans the full map width and would be cropped, vertical outputs can't have one", output.name())
+		}
+		if output.Format == "gif" {
+			continue
+		}
+		outputEncoder := video.outputEncoder(&output)
+		if err := outputEncoder.validate(); err != nil {
+			return fmt.Errorf("output %q: %w", output.name(), err)
+		}
+	}
+	return nil
+}
+
+// buildOutputs renders every declared output from the clip sources, so each
+// rendition is encoded once from the original frames.
+func buildOutputs(video *Video, plans []clipPlan, clips []OutputClip, srtFilePath string, outputDir string) ([]OutputFile, error) {
+	var outputFiles []OutputFile
+	var renditions []hlsRendition
+	hlsDir := filepath.Join(outputDir, video.Filename+"-hls")
+	for _, output := range video.Outputs {
+		// The video scale is for the landscape canvas, vertical outputs keep
+		// their portrait size unless they set their own
+		scale := output.Scale
+		if scale == "" && !output.Vertical {
+			scale = video.Scale
+		}
+		filePath := filepath.Join(outputDir, fmt.Sprintf("%v-%v.%v", video.Filename, output.name(), output.Format))
+		if output.Format == "gif" {
+			if err := encodeGif(video, plans, &output, scale, totalDuration(clips), filePath); err != nil {
+				return nil, err
+			}
+			outputFiles = append(outputFiles, OutputFile{Name: output.name(), Format: output.Format, FilePath: filePath})
+			continue
+		}
+		outputEncoder := video.outputEncoder(&output)
+		outputArgs := outputEncoder.outputArgs()
+		outputArgs["r"] = video.frameRate()
+
+		// Format specific arguments
+		if output.Format == "hls" {
+			if err := os.MkdirAll(hlsDir, os.ModePerm); err != nil {
+				return nil, err
+			}
+			filePath = filepath.Join(hlsDir, output.name()+".m3u8")
+			outputArgs["f"] = "hls"
+			outputArgs["hls_time"] = default_hls_segment_sec
+			outputArgs["hls_playlist_type"] = "vod"
+			outputArgs["hls_segment_filename"] = filepath.Join(hlsDir, output.name()+"_%03d.ts")
+		}
+
+		// Encode
+		stream := video.clipStream(plans, scale, output.Vertical)
+		tracker := newProgressTracker(video.Filename, output.name(), totalDuration(clips))
+		if err := runStream(stream.Output(filePath, outputArgs).OverWriteOutput(), tracker); err != nil {
+			return nil, err
+		}
+		if output.Format == "mp4" {
+			if err := embedMetadata(filePath, clips, srtFilePath, video.Subtitles.language()); err != nil {
+				return nil, err
+			}
+		}
+		if output.Format == "hls" {
+			bandwidth, _ := parseBitrate(output.Bitrate)
+			renditions = append(renditions, hlsRendition{filePath: filePath, bandwidth: bandwidth})
+		}
+		outputFiles = append(outputFiles, OutputFile{Name: output.name(), Format: output.Format, FilePath: filePath})
+	}
+
+	// Tie HLS renditions together
+	if len(renditions) > 0 {
+		masterFilePath := filepath.Join(hlsDir, "master.m3u8")
+		if err := writeHlsMaster(masterFilePath, renditions); err != nil {
+			return nil, err
+		}
+		outputFiles = append(outputFiles, OutputFile{Name: default_hls_master_name, Format: "hls", FilePath: masterFilePath})
+	}
+	return outputFiles, nil
+}
+
+// encodeGif runs two passes, the first generates a palette from the whole
+// video and the second maps the frames onto it.
+func encodeGif(video *Video, plans []clipPlan, output *output, scale string, durationSec float64, filePath string) error {
+	paletteFilePath := strings.TrimSuffix(filePath, ".gif") + "-palette.png"
+	defer os.Remove(paletteFilePath)
+	paletteStream := video.clipStream(plans, scale, output.Vertical).Filter("palettegen", nil)
+	paletteTracker := newProgressTracker(video.Filename, output.name()+" palette", durationSec)
+	if err := runStream(paletteStream.Output(paletteFilePath).OverWriteOutput(), paletteTracker); err != nil {
+		return err
+	}
+	palette := ffmpeg.Input(paletteFilePath)
+	gifStream := ffmpeg.Filter([]*ffmpeg.Stream{video.clipStream(plans, scale, output.Vertical), palette}, "paletteuse", nil)
+	tracker := newProgressTracker(video.Filename, output.name(), durationSec)
+	return runStream(gifStream.Output(filePath, ffmpeg.KwArgs{"r": video.frameRate()}).OverWriteOutput(), tracker)
+}
+
+func writeHlsMaster(filePath string, renditions []hlsRendition) error {
+	var builder strings.Builder
+	builder.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, rendition := range renditions {
+		attributes := fmt.Sprintf("BANDWIDTH=%v", rendition.bandwidth)
+		if width, height, err := probeDimensions(rendition.filePath); err == nil {
+			attributes += fmt.Sprintf(",RESOLUTION=%vx%v", width, height)
+		}
+		fmt.Fprintf(&builder, "#EXT-X-STREAM-INF:%v\n%v\n", attributes, filepath.Base(rendition.filePath))
+	}
+	return os.WriteFile(filePath, []byte(builder.String()), 0644)
+}
+
+func probeDimensions(filePath string) (int, int, error) {
+	data, err := probe(filePath, "stream=width,height")
+	if err != nil {
+		return 0, 0, err
+	}
+	var dimensions struct {
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(data, &dimensions); err != nil {
+		return 0, 0, err
+	}
+	if len(dimensions.Streams) == 0 {
+		return 0, 0, fmt.Errorf("no video stream in %v", filePath)
+	}
+	return dimensions.Streams[0].Width, dimensions.Streams[0].Height, nil
+}
+
+// parseBitrate converts ffmpeg style bitrates such as 2500k or 3M to bits per second.
+func parseBitrate(bitrate string) (int, error) {
+	multiplier := 1.0
+	number := bitrate
+	switch {
+	case strings.HasSuffix(bitrate, "k"), strings.HasSuffix(bitrate, "K"):
+		multiplier, number = 1000, bitrate[:len(bitrate)-1]
+	case strings.HasSuffix(bitrate, "M"):
+		multiplier, number = 1000000, bitrate[:len(bitrate)-1]
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid bitrate %q", bitrate)
+	}
+	return int(value * multiplier), nil
+}
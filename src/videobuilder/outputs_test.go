@@ -0,0 +1,58 @@
+package videobuilder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOutputs(t *testing.T) {
+	video := Video{Outputs: []output{
+		{Name: "loop", Format: "gif"},
+		{Format: "webm"},
+		{Name: "720p", Format: "hls", Bitrate: "3M"},
+	}}
+	assert.Nil(t, video.validateOutputs())
+	assert.Equal(t, "webm", video.Outputs[1].name())
+	assert.Equal(t, "libvpx-vp9", video.Outputs[1].codec("libx264"))
+	assert.Equal(t, "libx265", video.Outputs[2].codec("libx265"))
+
+	invalid := [][]output{
+		{{Format: "avi"}},
+		{{Format: "webm"}, {Format: "webm"}},
+		{{Name: "default", Format: "mp4"}},
+		{{Format: "hls"}},
+		{{Format: "mp4", Bitrate: "fast"}},
+	}
+	for _, outputs := range invalid {
+		video.Outputs = outputs
+		assert.NotNil(t, video.validateOutputs(), "%+v", outputs)
+	}
+}
+
+func TestParseBitrate(t *testing.T) {
+	for bitrate, expected := range map[string]int{"2500k": 2500000, "3M": 3000000, "1.5M": 1500000, "800000": 800000} {
+		value, err := parseBitrate(bitrate)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, value, bitrate)
+	}
+	_, err := parseBitrate("-1k")
+	assert.NotNil(t, err)
+}
+
+func TestWriteHlsMaster(t *testing.T) {
+	tempDir := t.TempDir()
+	masterFilePath := filepath.Join(tempDir, "master.m3u8")
+	renditions := []hlsRendition{
+		{filePath: filepath.Join(tempDir, "720p.m3u8"), bandwidth: 3000000},
+		{filePath: filepath.Join(tempDir, "480p.m3u8"), bandwidth: 1500000},
+	}
+	assert.Nil(t, writeHlsMaster(masterFilePath, renditions))
+
+	// Renditions that can't be probed are listed without a resolution
+	data, err := os.ReadFile(masterFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=3000000\n720p.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=1500000\n480p.m3u8\n", string(data))
+}
@@ -0,0 +1,96 @@
+package videobuilder
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	default_progress_log_interval = 10 * time.Second
+)
+
+// ProgressReport describes how far along an encode is.
+type ProgressReport struct {
+	Video   string
+	Output  string
+	Percent float64
+	Frame   int
+	Fps     float64
+	Elapsed time.Duration
+	Eta     time.Duration
+	Done    bool
+}
+
+var (
+	progressLock        sync.Mutex
+	progressSubscribers []func(ProgressReport)
+)
+
+// SubscribeProgress registers a function called with every progress update
+// ffmpeg reports, from the goroutine running the encode.
+func SubscribeProgress(subscriber func(ProgressReport)) {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	progressSubscribers = append(progressSubscribers, subscriber)
+}
+
+func publishProgress(report ProgressReport) {
+	progressLock.Lock()
+	subscribers := append([]func(ProgressReport){}, progressSubscribers...)
+	progressLock.Unlock()
+	for _, subscriber := range subscribers {
+		subscriber(report)
+	}
+}
+
+// progressTracker turns raw ffmpeg progress for one encode into reports.
+type progressTracker struct {
+	video    string
+	output   string
+	totalSec float64
+	started  time.Time
+	lastLog  time.Time
+}
+
+func newProgressTracker(video string, output string, totalSec float64) *progressTracker {
+	now := time.Now()
+	return &progressTracker{video: video, output: output, totalSec: totalSec, started: now, lastLog: now}
+}
+
+func (tracker *progressTracker) update(progress Progress) {
+	now := time.Now()
+	report := tracker.report(progress, now)
+
+	// Log periodically so long encodes show signs of life
+	if report.Done || now.Sub(tracker.lastLog) >= default_progress_log_interval {
+		tracker.lastLog = now
+		log.Printf("Encoding %v (%v): %.1f%%, frame %v, %.1f fps, elapsed %v, ETA %v\n",
+			report.Video, report.Output, report.Percent, report.Frame, report.Fps,
+			report.Elapsed.Round(time.Second), report.Eta.Round(time.Second))
+	}
+	publishProgress(report)
+}
+
+func (tracker *progressTracker) report(progress Progress, now time.Time) ProgressReport {
+	report := ProgressReport{
+		Video:   tracker.video,
+		Output:  tracker.output,
+		Frame:   progress.Frame,
+		Fps:     progress.Fps,
+		Elapsed: now.Sub(tracker.started),
+		Done:    progress.Done,
+	}
+	if tracker.totalSec > 0 {
+		report.Percent = progress.OutTimeSec / tracker.totalSec * 100
+	}
+	if report.Percent > 100 || report.Done {
+		report.Percent = 100
+	}
+
+	// Assume the remaining frames encode at the average rate so far
+	if report.Percent > 0 && report.Percent < 100 {
+		report.Eta = time.Duration(float64(report.Elapsed) * (100 - report.Percent) / report.Percent)
+	}
+	return report
+}
@@ -0,0 +1,167 @@
+package videobuilder
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	stderr_tail_lines = 20
+)
+
+// Runner runs ffmpeg and ffprobe. Run calls onProgress, when set, every time
+// ffmpeg reports progress.
+type Runner interface {
+	Run(args []string, onProgress func(Progress)) error
+	Probe(args []string) ([]byte, error)
+}
+
+var (
+	FfmpegRunner Runner
+)
+
+func init() {
+	FfmpegRunner = &ExecRunner{FfmpegPath: "ffmpeg", FfprobePath: "ffprobe"}
+}
+
+// Progress is the last state ffmpeg reported through -progress.
+type Progress struct {
+	Frame      int
+	Fps        float64
+	OutTimeSec float64
+	Speed      string
+	Done       bool
+}
+
+type FfmpegError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+	Progress Progress
+}
+
+func (ffmpegError *FfmpegError) Error() string {
+	lastLine := ffmpegError.Stderr
+	if index := strings.LastIndex(strings.TrimSpace(lastLine), "\n"); index >= 0 {
+		lastLine = lastLine[index+1:]
+	}
+	return fmt.Sprintf("ffmpeg exited with status %v at frame %v: %v", ffmpegError.ExitCode, ffmpegError.Progress.Frame, strings.TrimSpace(lastLine))
+}
+
+type ExecRunner struct {
+	FfmpegPath  string
+	FfprobePath string
+}
+
+func (runner *ExecRunner) Run(args []string, onProgress func(Progress)) error {
+	fullArgs := append([]string{"-nostats", "-progress", "pipe:1"}, args...)
+	log.Printf("Running: %v %v\n", runner.FfmpegPath, strings.Join(args, " "))
+	cmd := exec.Command(runner.FfmpegPath, fullArgs...)
+	stderr := &tailBuffer{maxLines: stderr_tail_lines}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	progress := readProgress(stdout, onProgress)
+	if err := cmd.Wait(); err != nil {
+		ffmpegError := &FfmpegError{Args: args, ExitCode: -1, Stderr: stderr.String(), Progress: progress}
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			ffmpegError.ExitCode = exitError.ExitCode()
+		}
+		return ffmpegError
+	}
+	return nil
+}
+
+func (runner *ExecRunner) Probe(args []string) ([]byte, error) {
+	cmd := exec.Command(runner.FfprobePath, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w: %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// readProgress consumes ffmpeg's key=value progress blocks, passing each
+// completed block to onProgress, and returns the last one.
+func readProgress(reader io.Reader, onProgress func(Progress)) Progress {
+	var progress Progress
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "frame":
+			progress.Frame, _ = strconv.Atoi(value)
+		case "fps":
+			progress.Fps, _ = strconv.ParseFloat(value, 64)
+		case "out_time_us":
+			if micros, err := strconv.ParseInt(value, 10, 64); err == nil {
+				progress.OutTimeSec = float64(micros) / 1000000
+			}
+		case "speed":
+			progress.Speed = strings.TrimSpace(value)
+		case "progress":
+			progress.Done = value == "end"
+			if onProgress != nil {
+				onProgress(progress)
+			}
+		}
+	}
+	return progress
+}
+
+// tailBuffer keeps the last lines written to it.
+type tailBuffer struct {
+	maxLines int
+	lines    []string
+	partial  string
+}
+
+func (buffer *tailBuffer) Write(data []byte) (int, error) {
+	text := buffer.partial + string(data)
+	parts := strings.Split(text, "\n")
+	buffer.partial = parts[len(parts)-1]
+	buffer.lines = append(buffer.lines, parts[:len(parts)-1]...)
+	if len(buffer.lines) > buffer.maxLines {
+		buffer.lines = buffer.lines[len(buffer.lines)-buffer.maxLines:]
+	}
+	return len(data), nil
+}
+
+func (buffer *tailBuffer) String() string {
+	lines := buffer.lines
+	if buffer.partial != "" {
+		lines = append(lines, buffer.partial)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// runStream compiles a stream graph and runs it, reporting progress against
+// the expected output duration.
+func runStream(stream *ffmpeg.Stream, tracker *progressTracker) error {
+	return FfmpegRunner.Run(stream.GetArgs(), tracker.update)
+}
+
+func probe(filePath string, entries string) ([]byte, error) {
+	args := []string{"-v", "error", "-select_streams", "v:0", "-show_entries", entries, "-of", "json", filePath}
+	return FfmpegRunner.Probe(args)
+}
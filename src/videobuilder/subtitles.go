@@ -0,0 +1,190 @@
+package videobuilder
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	default_cue_template       = `{{.Clip}}` + "\n" + `{{.Valid.Format "Mon, 2 Jan 3:04 PM MST"}} (+{{.ForecastHour}}h)`
+	default_subtitles_timezone = "UTC"
+	default_subtitles_language = "eng"
+)
+
+type cueData struct {
+	Clip         string
+	View         string
+	Frame        int
+	Valid        time.Time
+	Init         time.Time
+	ForecastHour int
+}
+
+type cueRenderer struct {
+	template *template.Template
+	location *time.Location
+}
+
+type frameSpan struct {
+	clipIndex int
+	frame     int
+	start     float64
+	end       float64
+}
+
+type cue struct {
+	start float64
+	end   float64
+	text  string
+}
+
+// frameSpans lays every displayed source image out on the output timeline.
+// Spans are stretched to the corrected clip boundaries so they stay aligned
+// with what ffprobe reported.
+func frameSpans(plans []clipPlan, clips []OutputClip, frameRate int) []frameSpan {
+	var spans []frameSpan
+	for clipIndex, plan := range plans {
+		if plan.fileCount == 0 {
+			continue
+		}
+		speed := plan.clip.speed()
+		stretch := 1.0
+		if expected := framesToSeconds(plan.frameCount, frameRate); expected > 0 {
+			stretch = clips[clipIndex].DurationSec / expected
+		}
+		step := framesToSeconds(1, frameRate) * stretch
+		clipStart := clips[clipIndex].StartTimeSec
+		for index, frame := range plan.clip.sequence(plan.fileCount, plan.frameCount) {
+			start := clipStart + float64(index*speed)*step
+			end := start + float64(speed)*step
+
+			// Single image loops repeat the same frame, merge them into one span
+			if count := len(spans); count > 0 && spans[count-1].clipIndex == clipIndex && spans[count-1].frame == frame {
+				spans[count-1].end = end
+				continue
+			}
+			spans = append(spans, frameSpan{clipIndex: clipIndex, frame: frame, start: start, end: end})
+		}
+
+		// The held last image runs to the end of the clip
+		spans[len(spans)-1].end = clipStart + float64(plan.frameCount)*step
+	}
+	return spans
+}
+
+func (subtitles *subtitles) language() string {
+	if subtitles.Language != "" {
+		return subtitles.Language
+	}
+	return default_subtitles_language
+}
+
+func newCueRenderer(subtitles *subtitles) (*cueRenderer, error) {
+	cueTemplate := subtitles.Template
+	if cueTemplate == "" {
+		cueTemplate = default_cue_template
+	}
+	parsed, err := template.New("cue").Parse(cueTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subtitle template: %w", err)
+	}
+	timezone := subtitles.Timezone
+	if timezone == "" {
+		timezone = default_subtitles_timezone
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	return &cueRenderer{template: parsed, location: location}, nil
+}
+
+// render builds the cue text for a displayed frame. Frames without recorded
+// valid times only show the clip name.
+func (renderer *cueRenderer) render(plan *clipPlan, clip OutputClip, frame int) (string, error) {
+	frameSet := plan.frameSet
+	if frameSet == nil || frame >= len(frameSet.Frames) {
+		return clip.Name, nil
+	}
+	data := cueData{
+		Clip:         clip.Name,
+		View:         plan.clip.View,
+		Frame:        frame,
+		Valid:        frameSet.Frames[frame].ValidTime.In(renderer.location),
+		Init:         frameSet.InitTime.In(renderer.location),
+		ForecastHour: frameSet.ForecastHour(frame),
+	}
+	var builder strings.Builder
+	if err := renderer.template.Execute(&builder, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(builder.String()), nil
+}
+
+func subtitleCues(renderer *cueRenderer, plans []clipPlan, clips []OutputClip, frameRate int) ([]cue, error) {
+	var cues []cue
+	for _, span := range frameSpans(plans, clips, frameRate) {
+		text, err := renderer.render(&plans[span.clipIndex], clips[span.clipIndex], span.frame)
+		if err != nil {
+			return nil, err
+		}
+		cues = append(cues, cue{start: span.start, end: span.end, text: text})
+	}
+	return cues, nil
+}
+
+func subtitleFilePath(subtitles []OutputSubtitle, format string) string {
+	for _, subtitle := range subtitles {
+		if subtitle.Format == format {
+			return subtitle.FilePath
+		}
+	}
+	return ""
+}
+
+func writeSubtitles(videoFilePath string, language string, renderer *cueRenderer, plans []clipPlan, clips []OutputClip, frameRate int) ([]OutputSubtitle, error) {
+	cues, err := subtitleCues(renderer, plans, clips, frameRate)
+	if err != nil {
+		return nil, err
+	}
+	basePath := strings.TrimSuffix(videoFilePath, ".mp4")
+	subtitles := []OutputSubtitle{
+		{Format: "vtt", Language: language, FilePath: basePath + ".vtt"},
+		{Format: "srt", Language: language, FilePath: basePath + ".srt"},
+	}
+	if err := os.WriteFile(subtitles[0].FilePath, []byte(formatWebVTT(cues)), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(subtitles[1].FilePath, []byte(formatSRT(cues)), 0644); err != nil {
+		return nil, err
+	}
+	return subtitles, nil
+}
+
+func formatWebVTT(cues []cue) string {
+	var builder strings.Builder
+	builder.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		fmt.Fprintf(&builder, "\n%v --> %v\n%v\n", formatCueTime(cue.start, "."), formatCueTime(cue.end, "."), cue.text)
+	}
+	return builder.String()
+}
+
+func formatSRT(cues []cue) string {
+	var builder strings.Builder
+	for index, cue := range cues {
+		fmt.Fprintf(&builder, "%v\n%v --> %v\n%v\n\n", index+1, formatCueTime(cue.start, ","), formatCueTime(cue.end, ","), cue.text)
+	}
+	return builder.String()
+}
+
+func formatCueTime(seconds float64, fractionSeparator string) string {
+	millis := int64(seconds*1000 + 0.5)
+	hours := millis / 3600000
+	minutes := millis / 60000 % 60
+	secs := millis / 1000 % 60
+	return fmt.Sprintf("%02d:%02d:%02d%v%03d", hours, minutes, secs, fractionSeparator, millis%1000)
+}
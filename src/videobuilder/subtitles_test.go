@@ -0,0 +1,80 @@
+package videobuilder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pashonic/arkstorm/src/utils/framemeta"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPlans() ([]clipPlan, []OutputClip) {
+	initTime := time.Date(2023, 2, 3, 0, 0, 0, 0, time.UTC)
+	frameSet := &framemeta.FrameSet{InitTime: initTime, Frames: []framemeta.Frame{
+		{File: "001.png", ValidTime: initTime.Add(12 * time.Hour)},
+		{File: "002.png", ValidTime: initTime.Add(18 * time.Hour)},
+	}}
+	plans := []clipPlan{
+		{clip: clip{Name: "Snow", View: "snow", Speed: 5}, fileCount: 2, frameCount: 10, frameSet: frameSet},
+		{clip: clip{Name: "Title", Time: 2}, fileCount: 1, frameCount: 50},
+	}
+	clips := []OutputClip{
+		{Name: "Snow", StartTimeSec: 0, DurationSec: 0.4},
+		{Name: "Title", StartTimeSec: 0.4, DurationSec: 2},
+	}
+	return plans, clips
+}
+
+func TestSubtitleCues(t *testing.T) {
+	plans, clips := testPlans()
+	renderer, err := newCueRenderer(&subtitles{})
+	assert.Nil(t, err)
+	cues, err := subtitleCues(renderer, plans, clips, 25)
+	assert.Nil(t, err)
+
+	// One cue per source image, looped static images merge into one
+	assert.Equal(t, 3, len(cues))
+	assert.Equal(t, "Snow\nFri, 3 Feb 12:00 PM UTC (+12h)", cues[0].text)
+	assert.InDelta(t, 0.2, cues[1].start, 0.0001)
+	assert.Equal(t, "Snow\nFri, 3 Feb 6:00 PM UTC (+18h)", cues[1].text)
+	assert.Equal(t, cue{start: 0.4, end: 2.4, text: "Title"}, cues[2])
+
+	// Corrected clip timing stretches the cues
+	clips[0].DurationSec = 0.8
+	clips[1].StartTimeSec = 0.8
+	cues, _ = subtitleCues(renderer, plans, clips, 25)
+	assert.InDelta(t, 0.4, cues[1].start, 0.0001)
+	assert.InDelta(t, 0.8, cues[2].start, 0.0001)
+
+	// Templates render in the configured timezone
+	renderer, err = newCueRenderer(&subtitles{Template: `{{.View}} {{.Frame}} {{.Valid.Format "15:04 MST"}}`, Timezone: "America/Los_Angeles"})
+	assert.Nil(t, err)
+	cues, _ = subtitleCues(renderer, plans, clips, 25)
+	assert.Equal(t, "snow 1 10:00 PST", cues[1].text)
+
+	_, err = newCueRenderer(&subtitles{Template: "{{.Clip"})
+	assert.NotNil(t, err)
+	_, err = newCueRenderer(&subtitles{Timezone: "Mars/Olympus"})
+	assert.NotNil(t, err)
+}
+
+func TestWriteSubtitles(t *testing.T) {
+	plans, clips := testPlans()
+	renderer, _ := newCueRenderer(&subtitles{Template: "{{.Clip}}"})
+	videoFilePath := filepath.Join(t.TempDir(), "winter.mp4")
+	subtitles, err := writeSubtitles(videoFilePath, "eng", renderer, plans, clips, 25)
+	assert.Nil(t, err)
+	assert.Equal(t, "srt", subtitles[1].Format)
+	assert.Equal(t, subtitles[1].FilePath, subtitleFilePath(subtitles, "srt"))
+
+	vtt, err := os.ReadFile(subtitles[0].FilePath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(vtt), "WEBVTT\n\n00:00:00.000 --> 00:00:00.200\nSnow\n")
+	srt, err := os.ReadFile(subtitles[1].FilePath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(srt), "3\n00:00:00,400 --> 00:00:02,400\nTitle\n\n")
+
+	assert.Equal(t, "01:02:03,046", formatCueTime(3723.0456, ","))
+}
@@ -0,0 +1,176 @@
+package videobuilder
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	default_text_anchor = "top-left"
+)
+
+// Anchors place the text against an edge or the center of the frame, the
+// cords offset it inwards from that edge
+var text_anchors = []string{"top-left", "top", "top-right", "left", "center", "right", "bottom-left", "bottom", "bottom-right"}
+
+type text struct {
+	Text  string
+	Cords struct {
+		X int
+		Y int
+	}
+	Color     string
+	Size      int
+	Start     float64 // Seconds into the clip, or the video for video texts, the text appears
+	End       float64 // Seconds the text disappears, shown until the end when zero
+	Fade      float64 // Seconds the text fades in and out over
+	Box       string  // Background box color, such as black@0.5
+	BoxBorder int     // Box padding around the text
+	Fontfile  string
+	Anchor    string
+}
+
+func (text *text) anchor() string {
+	if text.Anchor != "" {
+		return text.Anchor
+	}
+	return default_text_anchor
+}
+
+func (text *text) validate() error {
+	if text.Text == "" {
+		return fmt.Errorf("text: text can't be empty")
+	}
+	if !contains(text_anchors, text.anchor()) {
+		return fmt.Errorf("text %q: unsupported anchor %q", text.Text, text.Anchor)
+	}
+	if text.Start < 0 || text.Fade < 0 || text.BoxBorder < 0 {
+		return fmt.Errorf("text %q: start, fade and box border can't be negative", text.Text)
+	}
+	if text.End != 0 && text.End <= text.Start {
+		return fmt.Errorf("text %q: end must be after start", text.Text)
+	}
+	if text.Fontfile != "" {
+		if _, err := os.Stat(text.Fontfile); err != nil {
+			return fmt.Errorf("text %q: %w", text.Text, err)
+		}
+	}
+	return nil
+}
+
+// position returns the x and y expressions for the text's anchor.
+func (text *text) position() (string, string) {
+	vertical, horizontal, _ := strings.Cut(text.anchor(), "-")
+	switch vertical {
+	case "left", "right": // Single word anchors name the horizontal edge
+		vertical, horizontal = "center", vertical
+	case "top", "bottom", "center":
+		if horizontal == "" {
+			horizontal = "center"
+		}
+	}
+	x := fmt.Sprint(text.Cords.X)
+	switch horizontal {
+	case "center":
+		x = "(w-text_w)/2" + offset(text.Cords.X)
+	case "right":
+		x = fmt.Sprintf("w-text_w-%v", text.Cords.X)
+	}
+	y := fmt.Sprint(text.Cords.Y)
+	switch vertical {
+	case "center":
+		y = "(h-text_h)/2" + offset(text.Cords.Y)
+	case "bottom":
+		y = fmt.Sprintf("h-text_h-%v", text.Cords.Y)
+	}
+	return x, y
+}
+
+func offset(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+d", value)
+}
+
+// escapeOption escapes a filter option value. ffmpeg-go escapes the filter
+// graph level, but passes keyword values through without escaping them for
+// the option parser.
+func escapeOption(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	return replacer.Replace(value)
+}
+
+// drawtextArgs returns the drawtext options for the text. Expansion is off
+// so the text is drawn verbatim.
+func (text *text) drawtextArgs(durationSec float64) ffmpeg.KwArgs {
+	x, y := text.position()
+	args := ffmpeg.KwArgs{
+		"text":      escapeOption(text.Text),
+		"expansion": "none",
+		"x":         x,
+		"y":         y,
+	}
+	if text.Size > 0 {
+		args["fontsize"] = text.Size
+	}
+	if text.Color != "" {
+		args["fontcolor"] = escapeOption(text.Color)
+	}
+	if text.Fontfile != "" {
+		args["fontfile"] = escapeOption(text.Fontfile)
+	}
+	if text.Box != "" {
+		args["box"] = 1
+		args["boxcolor"] = escapeOption(text.Box)
+		args["boxborderw"] = text.BoxBorder
+	}
+
+	// Show the text inside its window, open ended windows run to the end
+	end := text.End
+	if end == 0 {
+		end = durationSec
+	}
+	if text.Start > 0 || text.End > 0 {
+		args["enable"] = fmt.Sprintf("between(t,%.4g,%.4g)", text.Start, end)
+	}
+
+	// Ramp the opacity up after the start and down before the end
+	if text.Fade > 0 {
+		start, end, fade := fmt.Sprintf("%.4g", text.Start), fmt.Sprintf("%.4g", end), fmt.Sprintf("%.4g", text.Fade)
+		args["alpha"] = fmt.Sprintf("if(lt(t,%[1]v),0,if(lt(t,%[1]v+%[3]v),(t-%[1]v)/%[3]v,if(lt(t,%[2]v-%[3]v),1,if(lt(t,%[2]v),(%[2]v-t)/%[3]v,0))))", start, end, fade)
+	}
+	return args
+}
+
+// drawTexts draws the texts onto the stream, durationSec is how long the
+// stream runs for.
+func drawTexts(stream *ffmpeg.Stream, texts []text, durationSec float64) *ffmpeg.Stream {
+	for _, text := range texts {
+		stream = stream.Filter("drawtext", nil, text.drawtextArgs(durationSec))
+	}
+	return stream
+}
+
+// allTexts returns the video texts and the landscape and portrait texts of
+// every clip.
+func (video *Video) allTexts() []text {
+	texts := append([]text{}, video.Texts...)
+	for _, clip := range video.Clips {
+		texts = append(texts, clip.Texts...)
+		texts = append(texts, clip.Portrait.Texts...)
+	}
+	return texts
+}
+
+func (video *Video) validateTexts() error {
+	for _, text := range video.allTexts() {
+		if err := text.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
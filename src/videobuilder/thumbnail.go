@@ -0,0 +1,280 @@
+package videobuilder
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	thumbnail_width          = 1280
+	thumbnail_height         = 720
+	thumbnail_jpeg_quality   = 90
+	thumbnail_margin         = 40
+	thumbnail_title_size     = 72
+	thumbnail_min_title_size = 36
+	thumbnail_date_size      = 36
+	thumbnail_logo_height    = 96
+	default_thumbnail_frame  = "peak"
+)
+
+var thumbnail_frames = []string{"first", "middle", "last", "peak"}
+
+type thumbnail struct {
+	Clip  string // Name of the clip the frame is taken from, defaults to the first clip
+	Frame string // first, middle, last, peak or a frame index
+	Title string // Defaults to the video file name
+	Logo  string // Branding image drawn in the top right corner
+}
+
+func (thumbnail *thumbnail) frame() string {
+	if thumbnail.Frame != "" {
+		return thumbnail.Frame
+	}
+	return default_thumbnail_frame
+}
+
+func (video *Video) validateThumbnail() error {
+	thumbnail := video.Thumbnail
+	if thumbnail == nil {
+		return nil
+	}
+	if _, err := strconv.Atoi(thumbnail.frame()); err != nil && !contains(thumbnail_frames, thumbnail.frame()) {
+		return fmt.Errorf("thumbnail: unsupported frame %q", thumbnail.Frame)
+	}
+	if thumbnail.Clip != "" {
+		found := false
+		for _, clip := range video.Clips {
+			found = found || clip.Name == thumbnail.Clip
+		}
+		if !found {
+			return fmt.Errorf("thumbnail: no clip named %q", thumbnail.Clip)
+		}
+	}
+	if thumbnail.Logo != "" {
+		if _, err := os.Stat(thumbnail.Logo); err != nil {
+			return fmt.Errorf("thumbnail: %w", err)
+		}
+	}
+	return nil
+}
+
+func (video *Video) thumbnailTitle() string {
+	if video.Thumbnail.Title != "" {
+		return video.Thumbnail.Title
+	}
+	return strings.ReplaceAll(video.Filename, "-", " ")
+}
+
+// thumbnailPlan returns the plan of the clip the thumbnail is taken from.
+func (video *Video) thumbnailPlan(plans []clipPlan) *clipPlan {
+	for index := range plans {
+		if video.Thumbnail.Clip == "" || plans[index].clip.Name == video.Thumbnail.Clip {
+			return &plans[index]
+		}
+	}
+	return nil
+}
+
+// thumbnailFrame resolves the configured frame to a source image index.
+func thumbnailFrame(plan *clipPlan, frame string) (int, error) {
+	last := plan.fileCount - 1
+	switch frame {
+	case "first":
+		return 0, nil
+	case "middle":
+		return last / 2, nil
+	case "last":
+		return last, nil
+	case "peak":
+		return peakFrame(plan)
+	}
+	index, err := strconv.Atoi(frame)
+	if err != nil {
+		return 0, err
+	}
+	if index < 0 || index > last {
+		return 0, fmt.Errorf("thumbnail: frame %v is outside clip %q with %v frames", index, plan.clip.Name, plan.fileCount)
+	}
+	return index, nil
+}
+
+// peakFrame returns the most colorful frame, on weather maps that is the one
+// with the most shaded precipitation, wind or temperature extremes.
+func peakFrame(plan *clipPlan) (int, error) {
+	peak, peakScore := 0, -1.0
+	for index := 0; index < plan.fileCount; index++ {
+		img, err := loadImage(filepath.Join(plan.sourceDir, fmt.Sprintf("%03d.png", index)))
+		if err != nil {
+			return 0, err
+		}
+		if score := colorfulness(img); score > peakScore {
+			peak, peakScore = index, score
+		}
+	}
+	return peak, nil
+}
+
+// colorfulness returns the mean saturation of a sample of the image pixels.
+func colorfulness(img image.Image) float64 {
+	bounds := img.Bounds()
+	step := bounds.Dx() / 200
+	if step < 1 {
+		step = 1
+	}
+	total, samples := 0.0, 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			samples++
+			if a == 0 {
+				continue
+			}
+			high, low := r, r
+			for _, channel := range []uint32{g, b} {
+				if channel > high {
+					high = channel
+				}
+				if channel < low {
+					low = channel
+				}
+			}
+			if high > 0 {
+				total += float64(high-low) / float64(high)
+			}
+		}
+	}
+	if samples == 0 {
+		return 0
+	}
+	return total / float64(samples)
+}
+
+func loadImage(filePath string) (image.Image, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// renderThumbnail draws the thumbnail from the configured frame and returns
+// its path, or an empty path when the video doesn't have one configured.
+func renderThumbnail(video *Video, plans []clipPlan, outputDir string) (string, error) {
+	if video.Thumbnail == nil {
+		return "", nil
+	}
+	plan := video.thumbnailPlan(plans)
+	if plan == nil || plan.fileCount == 0 {
+		return "", fmt.Errorf("thumbnail: clip has no frames")
+	}
+	frame, err := thumbnailFrame(plan, video.Thumbnail.frame())
+	if err != nil {
+		return "", err
+	}
+	source, err := loadImage(filepath.Join(plan.sourceDir, fmt.Sprintf("%03d.png", frame)))
+	if err != nil {
+		return "", err
+	}
+
+	// Cover the canvas with the frame
+	canvas := image.NewRGBA(image.Rect(0, 0, thumbnail_width, thumbnail_height))
+	draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(canvas, coverRect(source.Bounds(), canvas.Bounds()), source, source.Bounds(), draw.Over, nil)
+
+	// Shade the bottom so the text reads over any map
+	for y := thumbnail_height / 2; y < thumbnail_height; y++ {
+		alpha := uint8(200 * (y - thumbnail_height/2) / (thumbnail_height / 2))
+		shade := image.NewUniform(color.RGBA{A: alpha})
+		draw.Draw(canvas, image.Rect(0, y, thumbnail_width, y+1), shade, image.Point{}, draw.Over)
+	}
+
+	// Title and run date
+	dateY := thumbnail_height - thumbnail_margin
+	if plan.frameSet != nil && !plan.frameSet.InitTime.IsZero() {
+		runDate := "Run " + plan.frameSet.InitTime.UTC().Format("Mon, 2 Jan 2006 15Z")
+		if err := drawThumbnailText(canvas, goregular.TTF, thumbnail_date_size, runDate, dateY); err != nil {
+			return "", err
+		}
+		dateY -= thumbnail_date_size + thumbnail_margin/2
+	}
+	if err := drawThumbnailText(canvas, gobold.TTF, thumbnail_title_size, video.thumbnailTitle(), dateY); err != nil {
+		return "", err
+	}
+
+	// Branding
+	if video.Thumbnail.Logo != "" {
+		logo, err := loadImage(video.Thumbnail.Logo)
+		if err != nil {
+			return "", err
+		}
+		logoBounds := logo.Bounds()
+		logoWidth := logoBounds.Dx() * thumbnail_logo_height / logoBounds.Dy()
+		logoRect := image.Rect(thumbnail_width-thumbnail_margin-logoWidth, thumbnail_margin, thumbnail_width-thumbnail_margin, thumbnail_margin+thumbnail_logo_height)
+		draw.CatmullRom.Scale(canvas, logoRect, logo, logoBounds, draw.Over, nil)
+	}
+
+	// Save thumbnail
+	filePath := filepath.Join(outputDir, video.Filename+"-thumbnail.jpg")
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	if err := jpeg.Encode(file, canvas, &jpeg.Options{Quality: thumbnail_jpeg_quality}); err != nil {
+		file.Close()
+		return "", err
+	}
+	return filePath, file.Close()
+}
+
+// coverRect returns the rectangle the source is drawn into so it covers the
+// target, centered and cropped on the long side.
+func coverRect(source image.Rectangle, target image.Rectangle) image.Rectangle {
+	scale := float64(target.Dx()) / float64(source.Dx())
+	if heightScale := float64(target.Dy()) / float64(source.Dy()); heightScale > scale {
+		scale = heightScale
+	}
+	width, height := int(float64(source.Dx())*scale), int(float64(source.Dy())*scale)
+	x, y := (target.Dx()-width)/2, (target.Dy()-height)/2
+	return image.Rect(x, y, x+width, y+height)
+}
+
+// drawThumbnailText draws white text with its baseline at y, shrinking the
+// font until it fits between the margins.
+func drawThumbnailText(canvas *image.RGBA, ttf []byte, size float64, text string, y int) error {
+	parsed, err := opentype.Parse(ttf)
+	if err != nil {
+		return err
+	}
+	maxWidth := fixed.I(thumbnail_width - 2*thumbnail_margin)
+	var face font.Face
+	for ; ; size -= 4 {
+		face, err = opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return err
+		}
+		if font.MeasureString(face, text) <= maxWidth || size <= thumbnail_min_title_size {
+			break
+		}
+		face.Close()
+	}
+	defer face.Close()
+	drawer := &font.Drawer{Dst: canvas, Src: image.White, Face: face, Dot: fixed.P(thumbnail_margin, y)}
+	drawer.DrawString(text)
+	return nil
+}
@@ -0,0 +1,214 @@
+package videobuilder
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	default_timeline_height = 24
+	default_timeline_track  = "#00000099"
+	default_timeline_fill   = "#FFFFFF66"
+	default_timeline_tick   = "#FFFFFFCC"
+	default_timeline_cursor = "#FF0000FF"
+	timeline_tick_width     = 2
+	timeline_cursor_width   = 4
+	timeline_label_margin   = 4
+)
+
+type timeline struct {
+	Height   int    // Bar height in source image pixels
+	Track    string // Bar background color as #RRGGBB or #RRGGBBAA
+	Fill     string // Color of the elapsed part of the window
+	Tick     string // Day tick and label color
+	Cursor   string // Current frame marker color
+	Timezone string // Timezone day ticks fall on, defaults to the subtitle timezone
+}
+
+type timelineStyle struct {
+	height                    int
+	track, fill, tick, cursor color.RGBA
+	location                  *time.Location
+}
+
+func (timeline *timeline) style(subtitles *subtitles) (*timelineStyle, error) {
+	style := &timelineStyle{height: timeline.Height}
+	if style.height == 0 {
+		style.height = default_timeline_height
+	}
+	colors := []struct {
+		value, fallback string
+		target          *color.RGBA
+	}{
+		{timeline.Track, default_timeline_track, &style.track},
+		{timeline.Fill, default_timeline_fill, &style.fill},
+		{timeline.Tick, default_timeline_tick, &style.tick},
+		{timeline.Cursor, default_timeline_cursor, &style.cursor},
+	}
+	for _, entry := range colors {
+		value := entry.value
+		if value == "" {
+			value = entry.fallback
+		}
+		parsed, err := parseHexColor(value)
+		if err != nil {
+			return nil, fmt.Errorf("timeline: %w", err)
+		}
+		*entry.target = parsed
+	}
+	timezone := timeline.Timezone
+	if timezone == "" {
+		timezone = subtitles.Timezone
+	}
+	if timezone == "" {
+		timezone = default_subtitles_timezone
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("timeline: %w", err)
+	}
+	style.location = location
+	return style, nil
+}
+
+// parseHexColor parses #RRGGBB or #RRGGBBAA colors.
+func parseHexColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 6 {
+		hex += "FF"
+	}
+	parsed, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", value)
+	}
+	return color.RGBA{R: uint8(parsed >> 24), G: uint8(parsed >> 16), B: uint8(parsed >> 8), A: uint8(parsed)}, nil
+}
+
+// renderTimelines draws the timeline onto a copy of every clip's frames and
+// points the plans at the copies. Clips without frame valid times, or with a
+// single frame, are left alone. The returned function removes the copies.
+func renderTimelines(video *Video, plans []clipPlan, outputDir string) (func(), error) {
+	timelineDir := filepath.Join(outputDir, video.Filename+"-timeline")
+	cleanup := func() { os.RemoveAll(timelineDir) }
+	if video.Timeline == nil {
+		return func() {}, nil
+	}
+	style, err := video.Timeline.style(&video.Subtitles)
+	if err != nil {
+		return nil, err
+	}
+	for index := range plans {
+		plan := &plans[index]
+		if plan.frameSet == nil || len(plan.frameSet.Frames) < plan.fileCount || plan.fileCount < 2 {
+			continue
+		}
+		clipDir := filepath.Join(timelineDir, fmt.Sprintf("%03d-%v", index, plan.clip.View))
+		if err := os.MkdirAll(clipDir, os.ModePerm); err != nil {
+			cleanup()
+			return nil, err
+		}
+		frames := plan.frameSet.Frames[:plan.fileCount]
+		first, last := frames[0].ValidTime, frames[len(frames)-1].ValidTime
+		for frame := range frames {
+			fileName := fmt.Sprintf("%03d.png", frame)
+			if err := drawTimelineFrame(filepath.Join(plan.sourceDir, fileName), filepath.Join(clipDir, fileName), style, first, last, frames[frame].ValidTime); err != nil {
+				cleanup()
+				return nil, err
+			}
+		}
+		plan.sourceDir = clipDir
+	}
+	return cleanup, nil
+}
+
+func drawTimelineFrame(sourceFilePath string, targetFilePath string, style *timelineStyle, first time.Time, last time.Time, valid time.Time) error {
+
+	// Load source frame
+	sourceFile, err := os.Open(sourceFilePath)
+	if err != nil {
+		return err
+	}
+	source, err := png.Decode(sourceFile)
+	sourceFile.Close()
+	if err != nil {
+		return err
+	}
+	img := image.NewRGBA(source.Bounds())
+	draw.Draw(img, img.Bounds(), source, source.Bounds().Min, draw.Src)
+
+	// Draw timeline
+	drawTimeline(img, style, first, last, valid)
+
+	// Save frame
+	targetFile, err := os.Create(targetFilePath)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(targetFile, img); err != nil {
+		targetFile.Close()
+		return err
+	}
+	return targetFile.Close()
+}
+
+// timelineX returns where a time falls along a bar width pixels wide.
+func timelineX(first time.Time, last time.Time, value time.Time, width int) int {
+	span := last.Sub(first)
+	if span <= 0 {
+		return 0
+	}
+	return int(float64(width-1) * float64(value.Sub(first)) / float64(span))
+}
+
+// dayTicks returns the midnights inside the window.
+func dayTicks(first time.Time, last time.Time, location *time.Location) []time.Time {
+	var ticks []time.Time
+	local := first.In(location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location).AddDate(0, 0, 1)
+	for !day.After(last) {
+		ticks = append(ticks, day)
+		day = day.AddDate(0, 0, 1)
+	}
+	return ticks
+}
+
+func drawTimeline(img *image.RGBA, style *timelineStyle, first time.Time, last time.Time, valid time.Time) {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	top := bounds.Max.Y - style.height
+	bar := func(x0 int, x1 int, fill color.RGBA) {
+		rect := image.Rect(bounds.Min.X+x0, top, bounds.Min.X+x1, bounds.Max.Y)
+		draw.Draw(img, rect, image.NewUniform(fill), image.Point{}, draw.Over)
+	}
+
+	// Track and elapsed part
+	cursorX := timelineX(first, last, valid, width)
+	bar(0, width, style.track)
+	bar(0, cursorX, style.fill)
+
+	// Day ticks, labelled with the day they start
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(style.tick), Face: basicfont.Face7x13}
+	for _, tick := range dayTicks(first, last, style.location) {
+		tickX := timelineX(first, last, tick, width)
+		bar(tickX, tickX+timeline_tick_width, style.tick)
+		if style.height >= basicfont.Face7x13.Height {
+			drawer.Dot = fixed.P(bounds.Min.X+tickX+timeline_label_margin, bounds.Max.Y-(style.height-basicfont.Face7x13.Ascent)/2)
+			drawer.DrawString(tick.Format("Mon"))
+		}
+	}
+
+	// Cursor
+	bar(cursorX-timeline_cursor_width/2, cursorX+timeline_cursor_width/2, style.cursor)
+}
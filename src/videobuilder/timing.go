@@ -0,0 +1,124 @@
+package videobuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+func (video *Video) frameRate() int {
+	if video.Framerate > 0 {
+		return video.Framerate
+	}
+	return default_frame_rate
+}
+
+func (clip *clip) speed() int {
+	if clip.Speed > 0 {
+		return clip.Speed
+	}
+	return default_clip_speed
+}
+
+// frameCount returns how many output frames a clip occupies. Every source
+// image is held for speed frames, static clips loop their images for Time
+// seconds before the speed multiplier is applied. Bounce clips show every
+// image but the last twice, and the hold is added at the end.
+func (clip *clip) frameCount(fileCount int, frameRate int) int {
+	if clip.Time > 0 {
+		return clip.Time * frameRate * clip.speed()
+	}
+	images := fileCount
+	if clip.Bounce && fileCount > 1 {
+		images = fileCount*2 - 1
+	}
+	return images*clip.speed() + clip.holdFrames(frameRate)
+}
+
+func framesToSeconds(frames int, frameRate int) float64 {
+	return float64(frames) / float64(frameRate)
+}
+
+func totalDuration(clips []OutputClip) float64 {
+	if len(clips) == 0 {
+		return 0
+	}
+	last := clips[len(clips)-1]
+	return last.StartTimeSec + last.DurationSec
+}
+
+type probePackets struct {
+	Packets []struct {
+		PtsTime string `json:"pts_time"`
+	} `json:"packets"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// verifyClipTiming reads the encoded packet timestamps back with ffprobe and
+// moves each clip boundary to the real timestamp of its first frame.
+func verifyClipTiming(filePath string, clips []OutputClip, clipFrames []int) error {
+	data, err := probe(filePath, "packet=pts_time:format=duration")
+	if err != nil {
+		return err
+	}
+	return correctClipTiming(data, clips, clipFrames)
+}
+
+func correctClipTiming(probeData []byte, clips []OutputClip, clipFrames []int) error {
+	var packets probePackets
+	if err := json.Unmarshal(probeData, &packets); err != nil {
+		return err
+	}
+
+	// Collect presentation timestamps, packets are listed in decode order
+	var timestamps []float64
+	for _, packet := range packets.Packets {
+		pts, err := strconv.ParseFloat(packet.PtsTime, 64)
+		if err != nil {
+			continue
+		}
+		timestamps = append(timestamps, pts)
+	}
+	sort.Float64s(timestamps)
+	duration, err := strconv.ParseFloat(packets.Format.Duration, 64)
+	if err != nil {
+		return fmt.Errorf("unable to read encoded duration: %w", err)
+	}
+
+	// Map the first frame of every clip to its real timestamp. A different
+	// frame count can't be put down to any one clip, so it fails the build
+	// rather than shifting chapters and subtitles
+	expectedFrames := 0
+	for _, frames := range clipFrames {
+		expectedFrames += frames
+	}
+	if len(timestamps) == 0 || expectedFrames == 0 {
+		return nil
+	}
+	if len(timestamps) != expectedFrames {
+		return fmt.Errorf("encoded %v frames, expected %v, clip timing can't be verified", len(timestamps), expectedFrames)
+	}
+	offset := timestamps[0]
+	startFrame := 0
+	for index := range clips {
+		if startFrame < len(timestamps) {
+			clips[index].StartTimeSec = timestamps[startFrame] - offset
+		} else { // Empty trailing clip
+			clips[index].StartTimeSec = duration
+		}
+		startFrame += clipFrames[index]
+	}
+
+	// Clip durations follow from the corrected boundaries
+	for index := range clips {
+		end := duration
+		if index+1 < len(clips) {
+			end = clips[index+1].StartTimeSec
+		}
+		clips[index].DurationSec = end - clips[index].StartTimeSec
+	}
+	return nil
+}
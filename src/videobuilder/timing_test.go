@@ -0,0 +1,45 @@
+package videobuilder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClipFrameCount(t *testing.T) {
+
+	// Animated clips hold every image for speed frames
+	assert.Equal(t, 36, (&clip{Speed: 3}).frameCount(12, 25))
+	assert.Equal(t, 12, (&clip{}).frameCount(12, 25))
+
+	// Static clips run for their time at the output frame rate
+	assert.Equal(t, 250, (&clip{Time: 10}).frameCount(1, 25))
+	assert.Equal(t, 600, (&clip{Time: 10, Speed: 2}).frameCount(1, 30))
+
+	// Durations keep fractional seconds
+	assert.InDelta(t, 1.44, framesToSeconds(36, 25), 0.0001)
+	assert.InDelta(t, 1.2, framesToSeconds(36, 30), 0.0001)
+	assert.InDelta(t, 10.6, totalDuration([]OutputClip{{StartTimeSec: 0, DurationSec: 0.6}, {StartTimeSec: 0.6, DurationSec: 10}}), 0.0001)
+	assert.Equal(t, 0.0, totalDuration(nil))
+}
+
+func TestCorrectClipTiming(t *testing.T) {
+
+	// Boundaries move to the encoded timestamps of each clip's first frame
+	clips := []OutputClip{{Name: "a"}, {Name: "b"}}
+	data := `{"packets":[{"pts_time":"0.12"},{"pts_time":"0.00"},{"pts_time":"0.05"},{"pts_time":"0.09"}],"format":{"duration":"0.16"}}`
+	assert.Nil(t, correctClipTiming([]byte(data), clips, []int{2, 2}))
+	assert.InDelta(t, 0, clips[0].StartTimeSec, 0.001)
+	assert.InDelta(t, 0.09, clips[0].DurationSec, 0.001)
+	assert.InDelta(t, 0.09, clips[1].StartTimeSec, 0.001)
+	assert.InDelta(t, 0.07, clips[1].DurationSec, 0.001)
+
+	// A frame short can't be attributed to a clip
+	data = `{"packets":[{"pts_time":"0.08"},{"pts_time":"0.00"},{"pts_time":"0.04"}],"format":{"duration":"0.12"}}`
+	err := correctClipTiming([]byte(data), clips, []int{2, 2})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "encoded 3 frames, expected 4")
+
+	// Garbage probe output
+	assert.NotNil(t, correctClipTiming([]byte("nope"), clips, []int{2, 2}))
+}
@@ -0,0 +1,118 @@
+package videobuilder
+
+import (
+	"fmt"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	default_portrait_position = 0.5
+	default_portrait_margin   = 10
+)
+
+type portrait struct {
+	Position *float64  // Window position across the map, 0 is the left edge and 1 the right edge
+	Pan      []float64 // Start and end position when the window pans during the clip
+	Texts    []text    // Portrait text layout, clip texts are re-laid out when empty
+}
+
+// verticalDimensions returns a 9:16 canvas as tall as the landscape one is wide.
+func verticalDimensions(dimW int, dimH int) (int, int) {
+	height := dimW
+	if dimH > height {
+		height = dimH
+	}
+	width := height * 9 / 16
+	return width - width%2, height
+}
+
+func (portrait *portrait) validate() error {
+	if len(portrait.Pan) != 0 && len(portrait.Pan) != 2 {
+		return fmt.Errorf("portrait pan takes a start and end position, got %v values", len(portrait.Pan))
+	}
+	positions := portrait.Pan
+	if portrait.Position != nil {
+		positions = append([]float64{*portrait.Position}, positions...)
+	}
+	for _, position := range positions {
+		if position < 0 || position > 1 {
+			return fmt.Errorf("portrait positions must be between 0 and 1, got %v", position)
+		}
+	}
+	return nil
+}
+
+// windowX returns the crop x expression for the clip's portrait window.
+func (portrait *portrait) windowX(durationSec float64) string {
+	if len(portrait.Pan) == 2 && durationSec > 0 {
+		from, to := portrait.Pan[0], portrait.Pan[1]
+		return fmt.Sprintf("(iw-ow)*(%.4g+(%.4g)*min(t/%.4g,1))", from, to-from, durationSec)
+	}
+	position := default_portrait_position
+	if portrait.Position != nil {
+		position = *portrait.Position
+	}
+	return fmt.Sprintf("(iw-ow)*%.4g", position)
+}
+
+func verticalClip(stream *ffmpeg.Stream, plan *clipPlan, dimW int, dimH int, frameRate int) *ffmpeg.Stream {
+	clip := plan.clip
+
+	// Cover the portrait canvas with the map, then cut out the window
+	stream = stream.Filter("scale", ffmpeg.Args{fmt.Sprintf("%v:%v", dimW, dimH)}, ffmpeg.KwArgs{"force_original_aspect_ratio": "increase"})
+	cropArgs := ffmpeg.KwArgs{
+		"w": dimW,
+		"h": dimH,
+		"x": clip.Portrait.windowX(framesToSeconds(plan.frameCount, frameRate)),
+		"y": "(ih-oh)/2",
+	}
+	stream = stream.Filter("crop", nil, cropArgs)
+
+	// Apply titles for the portrait canvas
+	return drawTexts(stream, portraitTexts(plan, dimW, dimH), framesToSeconds(plan.frameCount, frameRate))
+}
+
+// portraitTexts returns the configured portrait texts, or moves the clip
+// texts onto the portrait canvas. Moved texts are centered horizontally and
+// keep their height on the map, scaled the same way as the map itself.
+func portraitTexts(plan *clipPlan, dimW int, dimH int) []text {
+	if len(plan.clip.Portrait.Texts) > 0 {
+		return plan.clip.Portrait.Texts
+	}
+	factor, cropY := 1.0, 0.0
+	if plan.width > 0 && plan.height > 0 {
+		factor = float64(dimW) / float64(plan.width)
+		if heightFactor := float64(dimH) / float64(plan.height); heightFactor > factor {
+			factor = heightFactor
+		}
+		cropY = (float64(plan.height)*factor - float64(dimH)) / 2
+	}
+	var texts []text
+	for _, text := range plan.clip.Texts {
+		moved := text
+		moved.Size = int(float64(text.Size) * factor)
+		moved.Cords.X = 0
+
+		// Keep the vertical edge the text is anchored to, centered texts
+		// don't move with the crop
+		vertical, _, _ := strings.Cut(text.anchor(), "-")
+		switch vertical {
+		case "top", "bottom":
+			moved.Anchor = vertical
+			moved.Cords.Y = int(float64(text.Cords.Y)*factor - cropY)
+			if moved.Cords.Y < default_portrait_margin {
+				moved.Cords.Y = default_portrait_margin
+			}
+			if maxY := dimH - moved.Size - default_portrait_margin; moved.Cords.Y > maxY {
+				moved.Cords.Y = maxY
+			}
+		default:
+			moved.Anchor = "center"
+			moved.Cords.Y = int(float64(text.Cords.Y) * factor)
+		}
+		texts = append(texts, moved)
+	}
+	return texts
+}
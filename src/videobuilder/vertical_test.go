@@ -0,0 +1,55 @@
+package videobuilder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerticalDimensions(t *testing.T) {
+	width, height := verticalDimensions(1920, 1080)
+	assert.Equal(t, []int{1080, 1920}, []int{width, height})
+	width, height = verticalDimensions(1000, 600)
+	assert.Equal(t, []int{562, 1000}, []int{width, height})
+}
+
+func TestWindowX(t *testing.T) {
+	position := 0.3
+	assert.Equal(t, "(iw-ow)*0.5", (&portrait{}).windowX(10))
+	assert.Equal(t, "(iw-ow)*0.3", (&portrait{Position: &position}).windowX(10))
+	assert.Equal(t, "(iw-ow)*(0.25+(0.5)*min(t/10,1))", (&portrait{Pan: []float64{0.25, 0.75}}).windowX(10))
+}
+
+func placedText(value string, size int, x int, y int) text {
+	placed := text{Text: value, Size: size}
+	placed.Cords.X, placed.Cords.Y = x, y
+	return placed
+}
+
+func TestPortraitTexts(t *testing.T) {
+
+	// A 1920x1080 map covers the 1080x1920 canvas at 16/9 of its size
+	plan := &clipPlan{width: 1920, height: 1080, clip: clip{Texts: []text{
+		placedText("WA 2m Temp", 20, 715, 765),
+		placedText("Top", 20, 10, 2),
+		placedText("Bottom", 36, 10, 1070),
+	}}}
+	texts := portraitTexts(plan, 1080, 1920)
+	assert.Equal(t, 3, len(texts))
+	assert.Equal(t, "top", texts[0].Anchor)
+	assert.Equal(t, 0, texts[0].Cords.X)
+	assert.Equal(t, 35, texts[0].Size)
+	assert.Equal(t, 1360, texts[0].Cords.Y)
+
+	// Texts stay inside the canvas margins
+	assert.Equal(t, default_portrait_margin, texts[1].Cords.Y)
+	assert.Equal(t, 64, texts[2].Size)
+	assert.Equal(t, 1920-64-default_portrait_margin, texts[2].Cords.Y)
+
+	// Configured portrait texts are used as they are
+	plan.clip.Portrait.Texts = []text{placedText("Short", 48, 40, 1700)}
+	texts = portraitTexts(plan, 1080, 1920)
+	assert.Equal(t, 1, len(texts))
+	assert.Equal(t, 40, texts[0].Cords.X)
+	assert.Equal(t, 48, texts[0].Size)
+}
@@ -2,41 +2,59 @@ package videobuilder
 
 import (
 	"fmt"
+	"image/png"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	ffmpeg "github.com/u2takey/ffmpeg-go"
+
+	"github.com/pashonic/arkstorm/src/utils/framemeta"
 )
 
 const (
 	default_dimension_width  = 1920
 	default_dimension_height = 1080
+	default_frame_rate       = 25
+	default_clip_speed       = 1
 )
 
-type text struct {
-	Text  string
-	Cords struct {
-		X int
-		Y int
-	}
-	Color string
-	Size  int
+type clip struct {
+	View        string
+	Texts       []text
+	Name        string
+	Speed       int
+	Time        int
+	Portrait    portrait
+	Zoom        *zoom       // Pan and zoom over static clips
+	Hold        float64     // Seconds the last image of animated clips is held for
+	Bounce      bool        // Play animated clips forward, then in reverse
+	Interpolate interpolate // Fill in frames between images of animated clips
 }
 
-type clip struct {
-	View  string
-	Texts []text
-	Name  string
-	Speed int
-	Time  int
+type subtitles struct {
+	Template string
+	Timezone string
+	Language string
 }
 
 type Video struct {
 	Filename       string
 	OutputFilePath string
 	Scale          string
+	Framerate      int
 	Clips          []clip
+	Texts          []text    // Drawn over the whole video, timed against the video
+	Timeline       *timeline // Forecast timeline bar along the bottom of each clip
+	Thumbnail      *thumbnail
+	Subtitles      subtitles
+	Outputs        []output
+	Encoder        encoder
 	Dimensions     struct {
 		W int
 		H int
@@ -45,16 +63,71 @@ type Video struct {
 
 type OutputClip struct {
 	Name         string
-	StartTimeSec int
+	View         string
+	StartTimeSec float64
+	DurationSec  float64
+	InitTime     time.Time // Forecast cycle init, zero when the clip has no frame metadata
+	ValidStart   time.Time // Valid time of the first frame
+	ValidEnd     time.Time // Valid time of the last frame
 }
 
-type OutputVideo struct {
+type OutputSubtitle struct {
+	Format   string
+	Language string
 	FilePath string
-	Clips    []OutputClip
 }
 
-func BuildVideos(videos map[string]Video, assetDir string, outputDir string) (map[string]OutputVideo, error) {
-	returnVideos := map[string]OutputVideo{}
+type OutputFile struct {
+	Name     string
+	Format   string
+	FilePath string
+}
+
+type OutputVideo struct {
+	FilePath      string
+	DurationSec   float64
+	Clips         []OutputClip
+	Subtitles     []OutputSubtitle
+	Outputs       []OutputFile
+	ThumbnailPath string
+	InitTime      time.Time // Latest forecast cycle init across the clips, zero when unknown
+	CacheKey      string    // Hash of the build inputs
+	CacheHit      bool      // Outputs were reused from an earlier build with the same inputs
+}
+
+type clipPlan struct {
+	clip       clip
+	sourceDir  string
+	fileCount  int
+	frameCount int
+	frameSet   *framemeta.FrameSet
+	width      int
+	height     int
+}
+
+type BuildResult struct {
+	Videos map[string]OutputVideo // Videos that built, by video ID
+	Failed map[string]error       // Build errors, by video ID
+}
+
+// Err summarizes the failed videos, nil when every video built.
+func (result *BuildResult) Err() error {
+	if len(result.Failed) == 0 {
+		return nil
+	}
+	var failures []string
+	for videoId, err := range result.Failed {
+		failures = append(failures, fmt.Sprintf("%v: %v", videoId, err))
+	}
+	sort.Strings(failures)
+	return fmt.Errorf("%v of %v videos failed to build: %v", len(result.Failed), len(result.Failed)+len(result.Videos), strings.Join(failures, "; "))
+}
+
+// BuildVideos builds the videos concurrently, up to the configured job
+// limit. A failed video doesn't stop the others, failures are reported in
+// the result instead.
+func BuildVideos(videos map[string]Video, buildConfig *Build, assetDir string, outputDir string) (*BuildResult, error) {
+	result := &BuildResult{Videos: map[string]OutputVideo{}, Failed: map[string]error{}}
 
 	// Make sure output directory exists
 	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
@@ -62,70 +135,253 @@ func BuildVideos(videos map[string]Video, assetDir string, outputDir string) (ma
 	}
 
 	// Process videos
+	jobs := buildConfig.jobLimit()
+	log.Printf("Building %v videos, %v at a time\n", len(videos), jobs)
+	var lock sync.Mutex
+	var waitGroup sync.WaitGroup
+	slots := make(chan struct{}, jobs)
 	for videoId, video := range videos {
-		var outputVideo OutputVideo
-		outputVideo.FilePath = filepath.Join(outputDir, videos[videoId].Filename+".mp4")
-		returnClips, err := build(&video, assetDir, outputVideo.FilePath)
-		if err != nil {
-			return nil, err
-		}
-		outputVideo.Clips = returnClips
-		returnVideos[videoId] = outputVideo
+		waitGroup.Add(1)
+		go func(videoId string, video Video) {
+			defer waitGroup.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			var outputVideo OutputVideo
+			outputVideo.FilePath = filepath.Join(outputDir, video.Filename+".mp4")
+			err := build(&video, assetDir, outputDir, &outputVideo)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				log.Printf("Video %v failed: %v\n", videoId, err)
+				result.Failed[videoId] = err
+				return
+			}
+			result.Videos[videoId] = outputVideo
+		}(videoId, video)
 	}
-	return returnVideos, nil
+	waitGroup.Wait()
+	return result, nil
 }
 
-func build(video *Video, assetDir string, outputFilePath string) ([]OutputClip, error) {
-	returnClips := []OutputClip{}
+func build(video *Video, assetDir string, outputDir string, outputVideo *OutputVideo) error {
 
-	// Determine dimension
-	dimW := default_dimension_width
-	dimH := default_dimension_height
-	if video.Dimensions.W > 0 && video.Dimensions.H > 0 {
-		dimW = video.Dimensions.W
-		dimH = video.Dimensions.H
+	// Determine frame rate
+	frameRate := video.frameRate()
+
+	// Validate settings before any encoding starts
+	cueRenderer, err := newCueRenderer(&video.Subtitles)
+	if err != nil {
+		return err
+	}
+	videoEncoder := video.encoder()
+	if err := videoEncoder.validate(); err != nil {
+		return err
+	}
+	if err := video.validateOutputs(); err != nil {
+		return err
+	}
+	for _, clip := range video.Clips {
+		if err := clip.validateEffects(); err != nil {
+			return err
+		}
+		if err := clip.Portrait.validate(); err != nil {
+			return fmt.Errorf("clip %q: %w", clip.Name, err)
+		}
+	}
+	if err := video.validateTexts(); err != nil {
+		return err
+	}
+	if video.Timeline != nil {
+		if _, err := video.Timeline.style(&video.Subtitles); err != nil {
+			return err
+		}
+	}
+	if err := video.validateThumbnail(); err != nil {
+		return err
 	}
 
-	// Add views to input stream
-	var streamInputs []*ffmpeg.Stream
-	currentTimeSec := 0
+	// Plan clips and their timing
+	plans, returnClips, err := planClips(video, assetDir, frameRate)
+	if err != nil {
+		return err
+	}
+
+	// Reuse the outputs of an earlier build with identical inputs
+	key, err := cacheKey(video, plans)
+	if err != nil {
+		return err
+	}
+	cachePath := cacheFilePath(outputDir, video)
+	if cached, hit := readCache(cachePath, key); hit {
+		log.Printf("Video %v is unchanged, reusing %v\n", video.Filename, cached.FilePath)
+		*outputVideo = *cached
+		outputVideo.CacheHit = true
+		return nil
+	}
+	outputVideo.CacheKey = key
+	outputVideo.InitTime = initTime(plans)
+	if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Render the thumbnail from the original frames
+	if outputVideo.ThumbnailPath, err = renderThumbnail(video, plans, outputDir); err != nil {
+		return err
+	}
+
+	// Draw the timeline onto copies of the frames
+	cleanupTimelines, err := renderTimelines(video, plans, outputDir)
+	if err != nil {
+		return err
+	}
+	defer cleanupTimelines()
+
+	// Scale and build video
+	finalStream := video.clipStream(plans, video.Scale, false)
+	outputArgs := videoEncoder.outputArgs()
+	outputArgs["r"] = frameRate
+	tracker := newProgressTracker(video.Filename, default_output_name, totalDuration(returnClips))
+	if err := runStream(finalStream.Output(outputVideo.FilePath, outputArgs).OverWriteOutput(), tracker); err != nil {
+		return err
+	}
+
+	// Correct clip timing against what was actually encoded
+	if err := verifyClipTiming(outputVideo.FilePath, returnClips, planFrameCounts(plans)); err != nil {
+		return err
+	}
+	outputVideo.Clips = returnClips
+	outputVideo.DurationSec = totalDuration(returnClips)
+
+	// Write subtitle sidecars from the corrected clip timing
+	subtitles, err := writeSubtitles(outputVideo.FilePath, video.Subtitles.language(), cueRenderer, plans, returnClips, frameRate)
+	if err != nil {
+		return err
+	}
+	outputVideo.Subtitles = subtitles
+
+	// Embed chapters and the subtitle track into the container
+	srtFilePath := subtitleFilePath(subtitles, "srt")
+	if err := embedMetadata(outputVideo.FilePath, returnClips, srtFilePath, video.Subtitles.language()); err != nil {
+		return err
+	}
+	outputVideo.Outputs = []OutputFile{{Name: default_output_name, Format: "mp4", FilePath: outputVideo.FilePath}}
+
+	// Render additional outputs
+	renditions, err := buildOutputs(video, plans, returnClips, srtFilePath, outputDir)
+	if err != nil {
+		return err
+	}
+	outputVideo.Outputs = append(outputVideo.Outputs, renditions...)
+
+	// Record the finished build
+	return writeCache(cachePath, outputVideo)
+}
+
+func planClips(video *Video, assetDir string, frameRate int) ([]clipPlan, []OutputClip, error) {
+	plans := []clipPlan{}
+	returnClips := []OutputClip{}
+	currentFrame := 0
 	for _, clip := range video.Clips {
 		var outputClip OutputClip
 
-		// Create source paths
+		// Calculate clip time from output frame count
 		sourceDir := filepath.Join(assetDir, clip.View)
-		sourcePath := filepath.Join(sourceDir, "%03d.png")
+		fileCount, err := countFrameFiles(sourceDir) // Clip time depends on how many image files there are
+		if err != nil {
+			return nil, nil, err
+		}
+		frameCount := clip.frameCount(fileCount, frameRate)
+		outputClip.StartTimeSec = framesToSeconds(currentFrame, frameRate)
+		outputClip.DurationSec = framesToSeconds(frameCount, frameRate)
+		currentFrame += frameCount
 
-		// Set loop identifer and calulate clip time
-		fileList, err := ioutil.ReadDir(sourceDir) // Clip time depends on how many image files there are
+		// Load frame valid times, if the provider recorded them
+		frameSet, err := framemeta.Read(sourceDir)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		fileCount := float64(len(fileList))
-		outputClip.StartTimeSec = currentTimeSec
-		loop := "0"
-		if clip.Time > 0 { // We want to handle static frame segments differently
-			loop = "1"
-			currentTimeSec += int(clip.Time)
-		} else {
-			speedFloat := float64(clip.Speed)
-			currentTimeSec += int((fileCount * .04) * speedFloat)
+		plan := clipPlan{clip: clip, sourceDir: sourceDir, fileCount: fileCount, frameCount: frameCount, frameSet: frameSet}
+
+		// Source image size, used to lay out other canvas shapes
+		if fileCount > 0 {
+			if plan.width, plan.height, err = imageDimensions(filepath.Join(sourceDir, "000.png")); err != nil {
+				return nil, nil, err
+			}
 		}
+		plans = append(plans, plan)
 
-		// Process speed settings
-		streamInput := ffmpeg.Input(sourcePath, ffmpeg.KwArgs{"loop": loop, "t": clip.Time}).Filter("setpts", ffmpeg.Args{fmt.Sprintf("%v*PTS", clip.Speed)})
+		// Store return clip
+		outputClip.Name = clip.Name
+		outputClip.View = clip.View
+		if frameSet != nil && len(frameSet.Frames) > 0 {
+			outputClip.InitTime = frameSet.InitTime
+			outputClip.ValidStart = frameSet.Frames[0].ValidTime
+			outputClip.ValidEnd = frameSet.Frames[len(frameSet.Frames)-1].ValidTime
+		}
+		returnClips = append(returnClips, outputClip)
+	}
+	return plans, returnClips, nil
+}
 
-		// Apply titles, if specified
-		for _, text := range clip.Texts {
-			titleArgs := ffmpeg.Args{
-				fmt.Sprintf("text='%v'", text.Text),
-				fmt.Sprintf("x=%v", text.Cords.X),
-				fmt.Sprintf("y=%v", text.Cords.Y),
-				fmt.Sprintf("fontsize=%v", text.Size),
-				fmt.Sprintf("fontcolor=%v", text.Color),
-			}
-			streamInput = streamInput.Filter("drawtext", titleArgs)
+func totalFrames(plans []clipPlan) int {
+	total := 0
+	for _, plan := range plans {
+		total += plan.frameCount
+	}
+	return total
+}
+
+// initTime returns the latest cycle init of the clips with frame metadata.
+func initTime(plans []clipPlan) time.Time {
+	var latest time.Time
+	for _, plan := range plans {
+		if plan.frameSet != nil && plan.frameSet.InitTime.After(latest) {
+			latest = plan.frameSet.InitTime
 		}
+	}
+	return latest
+}
+
+func planFrameCounts(plans []clipPlan) []int {
+	var frameCounts []int
+	for _, plan := range plans {
+		frameCounts = append(frameCounts, plan.frameCount)
+	}
+	return frameCounts
+}
+
+func (video *Video) dimensions() (int, int) {
+	if video.Dimensions.W > 0 && video.Dimensions.H > 0 {
+		return video.Dimensions.W, video.Dimensions.H
+	}
+	return default_dimension_width, default_dimension_height
+}
+
+// clipStream builds the per-clip filter chains and joins them into one stream.
+func (video *Video) clipStream(plans []clipPlan, scale string, vertical bool) *ffmpeg.Stream {
+
+	// Determine dimension
+	dimW, dimH := video.dimensions()
+	if vertical {
+		dimW, dimH = verticalDimensions(dimW, dimH)
+	}
+
+	// Add views to input stream
+	var streamInputs []*ffmpeg.Stream
+	for _, plan := range plans {
+		clip := plan.clip
+		streamInput := clipPlayback(&plan, video.frameRate())
+
+		// Portrait clips are cropped from the map instead of letterboxed
+		if vertical {
+			streamInputs = append(streamInputs, verticalClip(streamInput, &plan, dimW, dimH, video.frameRate()))
+			continue
+		}
+
+		// Apply titles, if specified
+		streamInput = drawTexts(streamInput, clip.Texts, framesToSeconds(plan.frameCount, video.frameRate()))
 
 		// Force all input frames to be same size
 		scaleArgs := ffmpeg.Args{
@@ -139,14 +395,40 @@ func build(video *Video, assetDir string, outputFilePath string) ([]OutputClip,
 
 		// Add clip to pool
 		streamInputs = append(streamInputs, streamInput)
-
-		// Store return clip
-		outputClip.Name = clip.Name
-		returnClips = append(returnClips, outputClip)
 	}
 
-	// Scale and build video
+	// Join clips, draw video titles and scale
 	finalStream := ffmpeg.Concat(streamInputs)
-	finalStream = finalStream.Filter("scale", ffmpeg.Args{video.Scale})
-	return returnClips, finalStream.Output(outputFilePath).OverWriteOutput().Run()
+	finalStream = drawTexts(finalStream, video.Texts, framesToSeconds(totalFrames(plans), video.frameRate()))
+	if scale == "" {
+		return finalStream
+	}
+	return finalStream.Filter("scale", ffmpeg.Args{scale})
+}
+
+func imageDimensions(filePath string) (int, int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	config, err := png.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+func countFrameFiles(sourceDir string) (int, error) {
+	fileList, err := ioutil.ReadDir(sourceDir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, file := range fileList {
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".png" {
+			count++
+		}
+	}
+	return count, nil
 }
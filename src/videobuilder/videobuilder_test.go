@@ -0,0 +1,561 @@
+package videobuilder
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+
+	"github.com/pashonic/arkstorm/src/utils/framemeta"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+type fakeRunner struct {
+	lock        sync.Mutex
+	calls       []string
+	totalFrames int
+	frameRate   int
+}
+
+func (runner *fakeRunner) Run(args []string, onProgress func(Progress)) error {
+	runner.lock.Lock()
+	defer runner.lock.Unlock()
+	runner.calls = append(runner.calls, "ffmpeg "+strings.Join(args, " "))
+	if onProgress != nil {
+		onProgress(Progress{Done: true})
+	}
+
+	// Create the output file, global arguments follow it
+	outputFilePath := args[len(args)-1]
+	if outputFilePath == "-y" {
+		outputFilePath = args[len(args)-2]
+	}
+	return os.WriteFile(outputFilePath, nil, 0644)
+}
+
+func (runner *fakeRunner) Probe(args []string) ([]byte, error) {
+	runner.lock.Lock()
+	defer runner.lock.Unlock()
+	runner.calls = append(runner.calls, "ffprobe "+strings.Join(args, " "))
+	if !contains(args, "packet=pts_time:format=duration") {
+		return []byte(`{"streams":[{"width":1280,"height":720}]}`), nil
+	}
+	var packets []string
+	for frame := 0; frame < runner.totalFrames; frame++ {
+		packets = append(packets, fmt.Sprintf(`{"pts_time":"%f"}`, framesToSeconds(frame, runner.frameRate)))
+	}
+	duration := framesToSeconds(runner.totalFrames, runner.frameRate)
+	return []byte(fmt.Sprintf(`{"packets":[%v],"format":{"duration":"%f"}}`, strings.Join(packets, ","), duration)), nil
+}
+
+// writeTestAssets creates a view directory with small frames and frame metadata.
+func writeTestAssets(t *testing.T, assetDir string, view string, frameCount int) {
+	viewDir := filepath.Join(assetDir, view)
+	assert.Nil(t, os.MkdirAll(viewDir, os.ModePerm))
+	initTime := time.Date(2023, 2, 3, 12, 0, 0, 0, time.UTC)
+	frameSet := &framemeta.FrameSet{InitTime: initTime}
+	for index := 0; index < frameCount; index++ {
+		fileName := fmt.Sprintf("%03d.png", index)
+		file, err := os.Create(filepath.Join(viewDir, fileName))
+		assert.Nil(t, err)
+		assert.Nil(t, png.Encode(file, image.NewRGBA(image.Rect(0, 0, 64, 32))))
+		assert.Nil(t, file.Close())
+		frameSet.Frames = append(frameSet.Frames, framemeta.Frame{File: fileName, ValidTime: initTime.Add(time.Duration(index*6) * time.Hour)})
+	}
+	assert.Nil(t, framemeta.Write(viewDir, frameSet))
+}
+
+func testVideo() Video {
+	video := Video{Filename: "Test-Video", Scale: "-2:720"}
+	video.Clips = []clip{
+		{View: "temp", Name: "2m Temp", Speed: 5, Texts: []text{{Text: "2m Temp", Color: "red", Size: 20}}},
+		{View: "meteogram", Name: "Meteogram", Speed: 1, Time: 10},
+	}
+	video.Clips[0].Texts[0].Cords.X = 10
+	video.Clips[0].Texts[0].Cords.Y = 20
+	return video
+}
+
+func assertGolden(t *testing.T, name string, actual string) {
+	goldenFilePath := filepath.Join("testdata", name+".golden")
+	if *update {
+		assert.Nil(t, os.MkdirAll("testdata", os.ModePerm))
+		assert.Nil(t, os.WriteFile(goldenFilePath, []byte(actual), 0644))
+	}
+	expected, err := os.ReadFile(goldenFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), actual)
+}
+
+// runBuild builds the video against the fake runner and returns the
+// commands it ran and the subtitles it wrote, with temporary paths replaced.
+func runBuild(t *testing.T, video Video) (OutputVideo, string) {
+	tempDir := t.TempDir()
+	assetDir := filepath.Join(tempDir, "assets")
+	outputDir := filepath.Join(tempDir, "videos")
+	writeTestAssets(t, assetDir, "temp", 3)
+	writeTestAssets(t, assetDir, "meteogram", 1)
+	assert.Nil(t, os.MkdirAll(outputDir, os.ModePerm))
+
+	// Swap in the fake runner
+	frameRate := video.frameRate()
+	totalFrames := video.Clips[0].frameCount(3, frameRate) + video.Clips[1].frameCount(1, frameRate)
+	runner := &fakeRunner{frameRate: frameRate, totalFrames: totalFrames}
+	FfmpegRunner = runner
+	defer func() { FfmpegRunner = &ExecRunner{FfmpegPath: "ffmpeg", FfprobePath: "ffprobe"} }()
+
+	outputVideo := OutputVideo{FilePath: filepath.Join(outputDir, video.Filename+".mp4")}
+	assert.Nil(t, build(&video, assetDir, outputDir, &outputVideo))
+
+	lines := runner.calls
+	srtData, err := os.ReadFile(subtitleFilePath(outputVideo.Subtitles, "srt"))
+	assert.Nil(t, err)
+	lines = append(lines, "", string(srtData))
+	return outputVideo, strings.ReplaceAll(strings.Join(lines, "\n"), tempDir, "$TMP")
+}
+
+func TestBuildBasic(t *testing.T) {
+	outputVideo, commands := runBuild(t, testVideo())
+	assertGolden(t, "basic", commands)
+
+	// Check clip timing
+	assert.Equal(t, 2, len(outputVideo.Clips))
+	assert.InDelta(t, 0, outputVideo.Clips[0].StartTimeSec, 0.001)
+	assert.InDelta(t, 0.6, outputVideo.Clips[1].StartTimeSec, 0.001)
+	assert.InDelta(t, 10.6, outputVideo.DurationSec, 0.001)
+	assert.Equal(t, 1, len(outputVideo.Outputs))
+}
+
+func TestBuildFrameMismatch(t *testing.T) {
+	tempDir := t.TempDir()
+	assetDir := filepath.Join(tempDir, "assets")
+	writeTestAssets(t, assetDir, "temp", 3)
+	writeTestAssets(t, assetDir, "meteogram", 1)
+
+	// The encoder dropped a frame
+	video := testVideo()
+	runner := &fakeRunner{frameRate: default_frame_rate, totalFrames: 3*5 + 10*default_frame_rate - 1}
+	FfmpegRunner = runner
+	defer func() { FfmpegRunner = &ExecRunner{FfmpegPath: "ffmpeg", FfprobePath: "ffprobe"} }()
+
+	outputDir := filepath.Join(tempDir, "videos")
+	assert.Nil(t, os.MkdirAll(outputDir, os.ModePerm))
+	outputVideo := OutputVideo{FilePath: filepath.Join(outputDir, video.Filename+".mp4")}
+	err := build(&video, assetDir, outputDir, &outputVideo)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "expected 265")
+	assert.Empty(t, outputVideo.Clips)
+}
+
+func TestBuildOutputs(t *testing.T) {
+	video := testVideo()
+	video.Encoder = encoder{Crf: crf(18), Preset: "slow", Keyframes: 50}
+	video.Clips[0].Portrait.Pan = []float64{0.2, 0.8}
+	video.Outputs = []output{
+		{Name: "loop", Format: "gif", Scale: "640:-1"},
+		{Format: "webm"},
+		{Name: "short", Format: "mp4", Vertical: true},
+		{Name: "720p", Format: "hls", Bitrate: "3M"},
+		{Name: "480p", Format: "hls", Scale: "-2:480", Bitrate: "1500k"},
+	}
+	outputVideo, commands := runBuild(t, video)
+	assertGolden(t, "outputs", commands)
+
+	var names []string
+	for _, outputFile := range outputVideo.Outputs {
+		names = append(names, outputFile.Name)
+	}
+	assert.Equal(t, []string{"default", "loop", "webm", "short", "720p", "480p", "hls_master"}, names)
+
+	// The short is cropped to a full size portrait canvas and not scaled back
+	// down to the landscape scale
+	short := strings.Split(commands, "\n")[6]
+	assert.Contains(t, short, "crop=h=1920:w=1080:")
+	assert.NotContains(t, short, "scale=-2:720")
+
+	// Portrait windows must stay on the map
+	position := 1.5
+	assert.Nil(t, video.Clips[0].Portrait.validate())
+	assert.NotNil(t, (&portrait{Pan: []float64{0.2}}).validate())
+	assert.NotNil(t, (&portrait{Pan: []float64{0.2, 1.2}}).validate())
+	assert.NotNil(t, (&portrait{Position: &position}).validate())
+
+	// The timeline would be cropped off vertical outputs
+	video.Timeline = &timeline{}
+	assert.NotNil(t, video.validateOutputs())
+	video.Outputs = video.Outputs[:2]
+	assert.Nil(t, video.validateOutputs())
+	video.Timeline = nil
+
+	// Vertical outputs only scale to their own size
+	video.Outputs = []output{{Name: "short", Format: "mp4", Vertical: true, Scale: "720:1280"}}
+	_, commands = runBuild(t, video)
+	assert.Contains(t, strings.Split(commands, "\n")[3], "scale=720:1280[")
+}
+
+func TestBuildEffects(t *testing.T) {
+	video := testVideo()
+	video.Clips[0].Bounce = true
+	video.Clips[0].Hold = 1
+	focusX := 0.25
+	video.Clips[1].Zoom = &zoom{To: 1.5, X: &focusX}
+	outputVideo, commands := runBuild(t, video)
+	assertGolden(t, "effects", commands)
+
+	// Bounce plays five images, then the last is held for a second
+	assert.InDelta(t, 2, outputVideo.Clips[0].DurationSec, 0.001)
+	assert.InDelta(t, 2, outputVideo.Clips[1].StartTimeSec, 0.001)
+	assert.Equal(t, []int{0, 1, 2, 1, 0}, video.Clips[0].sequence(3, 50))
+
+	// Effects that don't fit the clip type are rejected
+	assert.NotNil(t, (&clip{Zoom: &zoom{}}).validateEffects())
+	assert.NotNil(t, (&clip{Time: 10, Hold: 2}).validateEffects())
+	assert.NotNil(t, (&clip{Time: 10, Zoom: &zoom{To: 0.5}}).validateEffects())
+	assert.Nil(t, (&clip{Time: 10, Zoom: &zoom{}}).validateEffects())
+	assert.NotNil(t, (&clip{Interpolate: interpolate{Mode: "optical"}}).validateEffects())
+	assert.NotNil(t, (&clip{Time: 10, Interpolate: interpolate{Mode: "blend"}}).validateEffects())
+}
+
+func TestBuildInterpolate(t *testing.T) {
+	video := testVideo()
+	video.Clips[0].Interpolate.Mode = "motion"
+	outputVideo, commands := runBuild(t, video)
+	assertGolden(t, "interpolate", commands)
+
+	// Interpolation leaves the clip timing alone
+	assert.InDelta(t, 0.6, outputVideo.Clips[1].StartTimeSec, 0.001)
+}
+
+func TestRenderTimelines(t *testing.T) {
+	tempDir := t.TempDir()
+	assetDir := filepath.Join(tempDir, "assets")
+	writeTestAssets(t, assetDir, "temp", 3)
+	writeTestAssets(t, assetDir, "meteogram", 1)
+	video := testVideo()
+	video.Timeline = &timeline{Height: 8, Cursor: "#FF0000"}
+	plans, _, err := planClips(&video, assetDir, video.frameRate())
+	assert.Nil(t, err)
+
+	cleanup, err := renderTimelines(&video, plans, tempDir)
+	assert.Nil(t, err)
+	timelineDir := filepath.Join(tempDir, "Test-Video-timeline", "000-temp")
+	assert.Equal(t, timelineDir, plans[0].sourceDir)
+
+	// The cursor moves from the start to the end of the window
+	readPixel := func(fileName string, x int, y int) color.RGBA {
+		file, err := os.Open(filepath.Join(timelineDir, fileName))
+		assert.Nil(t, err)
+		defer file.Close()
+		img, err := png.Decode(file)
+		assert.Nil(t, err)
+		return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	}
+	red := color.RGBA{R: 255, A: 255}
+	assert.Equal(t, red, readPixel("000.png", 0, 31))
+	assert.NotEqual(t, red, readPixel("000.png", 63, 31))
+	assert.Equal(t, red, readPixel("002.png", 62, 31))
+	assert.Equal(t, color.RGBA{}, readPixel("002.png", 62, 0)) // Above the bar
+
+	// Single frame clips have no window to show
+	assert.Equal(t, filepath.Join(assetDir, "meteogram"), plans[1].sourceDir)
+	cleanup()
+	_, err = os.Stat(timelineDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDayTicks(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	assert.Nil(t, err)
+	first := time.Date(2023, 2, 3, 12, 0, 0, 0, time.UTC)
+	ticks := dayTicks(first, first.Add(48*time.Hour), location)
+	assert.Equal(t, 2, len(ticks))
+	assert.Equal(t, time.Date(2023, 2, 4, 8, 0, 0, 0, time.UTC), ticks[0].UTC())
+	assert.Equal(t, 31, timelineX(first, first.Add(48*time.Hour), first.Add(24*time.Hour), 64))
+
+	_, err = parseHexColor("#12345")
+	assert.NotNil(t, err)
+}
+
+func TestRenderThumbnail(t *testing.T) {
+	tempDir := t.TempDir()
+	assetDir := filepath.Join(tempDir, "assets")
+	writeTestAssets(t, assetDir, "temp", 3)
+	writeTestAssets(t, assetDir, "meteogram", 1)
+
+	// Color in the middle frame so it's the peak
+	writePng := func(filePath string, fill color.Color) {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+		draw.Draw(img, img.Bounds(), image.NewUniform(fill), image.Point{}, draw.Src)
+		file, err := os.Create(filePath)
+		assert.Nil(t, err)
+		assert.Nil(t, png.Encode(file, img))
+		assert.Nil(t, file.Close())
+	}
+	writePng(filepath.Join(assetDir, "temp", "001.png"), color.RGBA{R: 200, G: 40, B: 40, A: 255})
+	logoFilePath := filepath.Join(tempDir, "logo.png")
+	writePng(logoFilePath, color.White)
+
+	video := testVideo()
+	video.Thumbnail = &thumbnail{Clip: "2m Temp", Logo: logoFilePath}
+	assert.Nil(t, video.validateThumbnail())
+	plans, _, err := planClips(&video, assetDir, video.frameRate())
+	assert.Nil(t, err)
+	frame, err := thumbnailFrame(&plans[0], "peak")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, frame)
+	_, err = thumbnailFrame(&plans[0], "3")
+	assert.NotNil(t, err)
+
+	filePath, err := renderThumbnail(&video, plans, tempDir)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(tempDir, "Test-Video-thumbnail.jpg"), filePath)
+	file, err := os.Open(filePath)
+	assert.Nil(t, err)
+	defer file.Close()
+	config, err := jpeg.DecodeConfig(file)
+	assert.Nil(t, err)
+	assert.Equal(t, 1280, config.Width)
+	assert.Equal(t, 720, config.Height)
+
+	// Unknown frames and clips are rejected before encoding
+	assert.NotNil(t, (&Video{Thumbnail: &thumbnail{Frame: "best"}}).validateThumbnail())
+	assert.NotNil(t, (&Video{Thumbnail: &thumbnail{Clip: "missing"}}).validateThumbnail())
+}
+
+func TestBuildVideos(t *testing.T) {
+	tempDir := t.TempDir()
+	assetDir := filepath.Join(tempDir, "assets")
+	writeTestAssets(t, assetDir, "temp", 3)
+	writeTestAssets(t, assetDir, "meteogram", 1)
+
+	runner := &fakeRunner{frameRate: default_frame_rate, totalFrames: 3*5 + 10*default_frame_rate}
+	FfmpegRunner = runner
+	defer func() { FfmpegRunner = &ExecRunner{FfmpegPath: "ffmpeg", FfprobePath: "ffprobe"} }()
+
+	// One video references a view that wasn't downloaded
+	broken := testVideo()
+	broken.Filename = "Broken"
+	broken.Clips[1].View = "missing"
+	second := testVideo()
+	second.Filename = "Second"
+	videos := map[string]Video{"first": testVideo(), "second": second, "broken": broken}
+
+	result, err := BuildVideos(videos, &Build{Jobs: 2}, assetDir, filepath.Join(tempDir, "videos"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result.Videos))
+	assert.Contains(t, result.Videos, "first")
+	assert.Contains(t, result.Videos, "second")
+	assert.Equal(t, 1, len(result.Failed))
+	assert.Contains(t, result.Failed, "broken")
+	assert.Contains(t, result.Err().Error(), "1 of 3 videos failed to build: broken:")
+}
+
+func TestBuildCache(t *testing.T) {
+	tempDir := t.TempDir()
+	assetDir := filepath.Join(tempDir, "assets")
+	outputDir := filepath.Join(tempDir, "videos")
+	writeTestAssets(t, assetDir, "temp", 3)
+	writeTestAssets(t, assetDir, "meteogram", 1)
+	assert.Nil(t, os.MkdirAll(outputDir, os.ModePerm))
+
+	runner := &fakeRunner{frameRate: default_frame_rate, totalFrames: 3*5 + 10*default_frame_rate}
+	FfmpegRunner = runner
+	defer func() { FfmpegRunner = &ExecRunner{FfmpegPath: "ffmpeg", FfprobePath: "ffprobe"} }()
+	buildVideo := func() OutputVideo {
+		video := testVideo()
+		outputVideo := OutputVideo{FilePath: filepath.Join(outputDir, video.Filename+".mp4")}
+		assert.Nil(t, build(&video, assetDir, outputDir, &outputVideo))
+		return outputVideo
+	}
+
+	// First build encodes, the second reuses it without running ffmpeg
+	first := buildVideo()
+	assert.False(t, first.CacheHit)
+	assert.NotEmpty(t, first.CacheKey)
+	calls := len(runner.calls)
+	second := buildVideo()
+	assert.True(t, second.CacheHit)
+	assert.Equal(t, calls, len(runner.calls))
+	assert.Equal(t, first.Clips, second.Clips)
+	assert.Equal(t, time.Date(2023, 2, 3, 12, 0, 0, 0, time.UTC), second.InitTime.UTC())
+
+	// A new frame invalidates the cache
+	writeTestAssets(t, assetDir, "temp", 4)
+	runner.totalFrames += 5
+	third := buildVideo()
+	assert.False(t, third.CacheHit)
+	assert.NotEqual(t, first.CacheKey, third.CacheKey)
+	assert.Greater(t, len(runner.calls), calls)
+}
+
+func TestCacheKeyReferencedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	fontFilePath := filepath.Join(tempDir, "font.ttf")
+	logoFilePath := filepath.Join(tempDir, "logo.png")
+	assert.Nil(t, os.WriteFile(fontFilePath, []byte("font"), 0644))
+	assert.Nil(t, os.WriteFile(logoFilePath, []byte("logo"), 0644))
+	video := testVideo()
+	video.Clips[0].Texts[0].Fontfile = fontFilePath
+	video.Thumbnail = &thumbnail{Logo: logoFilePath}
+	first, err := cacheKey(&video, nil)
+	assert.Nil(t, err)
+
+	// Replacing a font or logo in place changes the key
+	assert.Nil(t, os.WriteFile(fontFilePath, []byte("new font"), 0644))
+	second, err := cacheKey(&video, nil)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Nil(t, os.WriteFile(logoFilePath, []byte("new logo"), 0644))
+	third, err := cacheKey(&video, nil)
+	assert.Nil(t, err)
+	assert.NotEqual(t, second, third)
+}
+
+func TestJobLimit(t *testing.T) {
+	assert.Equal(t, 3, (&Build{Jobs: 3}).jobLimit())
+	jobs := (&Build{}).jobLimit()
+	assert.True(t, jobs >= 1 && jobs <= runtime.NumCPU(), "jobs %v", jobs)
+}
+
+func TestExecRunnerError(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	scriptData := "#!/bin/sh\necho frame=12\necho out_time_us=480000\necho progress=continue\necho 'Unknown encoder' >&2\nexit 3\n"
+	assert.Nil(t, os.WriteFile(script, []byte(scriptData), 0755))
+
+	runner := &ExecRunner{FfmpegPath: script}
+	var reports []Progress
+	err := runner.Run([]string{"-i", "input.mp4", "output.mp4"}, func(progress Progress) { reports = append(reports, progress) })
+	assert.Equal(t, 1, len(reports))
+	ffmpegError, ok := err.(*FfmpegError)
+	if !ok {
+		t.Fatalf("Expected FfmpegError, got %v", err)
+	}
+	assert.Equal(t, 3, ffmpegError.ExitCode)
+	assert.Equal(t, 12, ffmpegError.Progress.Frame)
+	assert.InDelta(t, 0.48, ffmpegError.Progress.OutTimeSec, 0.001)
+	assert.Equal(t, "Unknown encoder", ffmpegError.Stderr)
+	assert.Contains(t, ffmpegError.Error(), "status 3 at frame 12")
+}
+
+func TestProgressReport(t *testing.T) {
+	tracker := newProgressTracker("Test-Video", "default", 20)
+	now := tracker.started.Add(30 * time.Second)
+
+	// A quarter of the video took 30 seconds, three quarters remain
+	report := tracker.report(Progress{Frame: 125, Fps: 4.2, OutTimeSec: 5}, now)
+	assert.InDelta(t, 25, report.Percent, 0.001)
+	assert.Equal(t, 90*time.Second, report.Eta)
+	assert.Equal(t, 125, report.Frame)
+
+	// Finished encodes report complete regardless of the duration estimate
+	report = tracker.report(Progress{OutTimeSec: 19.96, Done: true}, now)
+	assert.Equal(t, 100.0, report.Percent)
+	assert.Equal(t, time.Duration(0), report.Eta)
+
+	// Subscribers see every update
+	var received []ProgressReport
+	SubscribeProgress(func(report ProgressReport) { received = append(received, report) })
+	tracker.update(Progress{OutTimeSec: 10})
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, "Test-Video", received[0].Video)
+}
+
+// getToken reads a token the way ffmpeg's av_get_token does, up to an
+// unescaped terminator, and returns it with the remaining input.
+func getToken(input string, terminators string) (string, string) {
+	var token strings.Builder
+	for index := 0; index < len(input); index++ {
+		char := input[index]
+		switch {
+		case char == '\\' && index+1 < len(input):
+			index++
+			token.WriteByte(input[index])
+		case char == '\'':
+			for index++; index < len(input) && input[index] != '\''; index++ {
+				token.WriteByte(input[index])
+			}
+		case strings.IndexByte(terminators, char) >= 0:
+			return token.String(), input[index:]
+		default:
+			token.WriteByte(char)
+		}
+	}
+	return token.String(), ""
+}
+
+// parseDrawtext unescapes a compiled drawtext filter the way ffmpeg parses
+// the filter graph and then the filter options.
+func parseDrawtext(t *testing.T, args []string) map[string]string {
+	var filterGraph string
+	for index, arg := range args {
+		if arg == "-filter_complex" && index+1 < len(args) {
+			filterGraph = args[index+1]
+		}
+	}
+	_, filterOptions, found := strings.Cut(filterGraph, "drawtext=")
+	assert.True(t, found, filterGraph)
+	options, _ := getToken(filterOptions, "[],;")
+	parsed := map[string]string{}
+	for options != "" {
+		key, rest := getToken(options, "=:")
+		value, rest := getToken(strings.TrimPrefix(rest, "="), ":")
+		parsed[key] = value
+		options = strings.TrimPrefix(rest, ":")
+	}
+	return parsed
+}
+
+func TestDrawtextEscaping(t *testing.T) {
+	titles := []string{
+		"2m Temp",
+		"It's 5:00 PM",
+		"Rain, snow; [mixed]",
+		`C:\fonts\bold`,
+		"100% chance = 'likely'",
+		"%{localtime}",
+	}
+	for _, title := range titles {
+		text := text{Text: title, Color: "white@0.8", Start: 1, Fade: 0.5, Box: "black@0.5"}
+		stream := ffmpeg.Input("in.png").Filter("drawtext", nil, text.drawtextArgs(10))
+		parsed := parseDrawtext(t, stream.Output("out.mp4").GetArgs())
+		assert.Equal(t, title, parsed["text"])
+		assert.Equal(t, "none", parsed["expansion"])
+		assert.Equal(t, "white@0.8", parsed["fontcolor"])
+		assert.Equal(t, "between(t,1,10)", parsed["enable"])
+		assert.Equal(t, "if(lt(t,1),0,if(lt(t,1+0.5),(t-1)/0.5,if(lt(t,10-0.5),1,if(lt(t,10),(10-t)/0.5,0))))", parsed["alpha"])
+	}
+}
+
+func TestTextPosition(t *testing.T) {
+	positions := map[string][2]string{
+		"":             {"10", "20"},
+		"top":          {"(w-text_w)/2+10", "20"},
+		"top-right":    {"w-text_w-10", "20"},
+		"left":         {"10", "(h-text_h)/2+20"},
+		"center":       {"(w-text_w)/2+10", "(h-text_h)/2+20"},
+		"bottom-right": {"w-text_w-10", "h-text_h-20"},
+	}
+	for anchor, expected := range positions {
+		text := text{Text: "a", Anchor: anchor}
+		text.Cords.X, text.Cords.Y = 10, 20
+		x, y := text.position()
+		assert.Equal(t, expected, [2]string{x, y}, anchor)
+	}
+	assert.NotNil(t, (&text{Text: "a", Anchor: "middle"}).validate())
+	assert.NotNil(t, (&text{Text: "a", Start: 5, End: 2}).validate())
+	assert.NotNil(t, (&text{Text: "a", Fontfile: "missing.ttf"}).validate())
+}
@@ -0,0 +1,134 @@
+package videouploader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+
+	"github.com/pashonic/arkstorm/src/utils/filestore"
+)
+
+const (
+	default_account_name = "default"
+	creds_bucket_env     = "AWS_S3_CREDS_BUCKET" // s3:// folder the job's credentials are copied from
+)
+
+var youtube_scopes = []string{youtube.YoutubeUploadScope, youtube.YoutubeScope, youtube.YoutubeForceSslScope}
+
+// Account is the credential set of a YouTube channel. Paths may be local or
+// s3://bucket/key and can reference environment variables as $VAR.
+type Account struct {
+	Secret    string // Client secret file, defaults to client_secret.json
+	SecretEnv string // Environment variable holding the client secret JSON, used over Secret
+	Token     string // OAuth token file, defaults to client_token.json
+}
+
+func (account *Account) secretPath() string {
+	if account.Secret != "" {
+		return os.ExpandEnv(account.Secret)
+	}
+	return default_client_secret_file
+}
+
+// tokenPath returns the token location. Without one configured, jobs with a
+// credentials bucket keep the token there so refreshes outlive the container.
+func (account *Account) tokenPath() string {
+	if account.Token != "" {
+		return os.ExpandEnv(account.Token)
+	}
+	if credsBucket := os.Getenv(creds_bucket_env); credsBucket != "" {
+		return strings.TrimSuffix(credsBucket, "/") + "/" + default_client_token_file
+	}
+	return default_client_token_file
+}
+
+func (account *Account) secret() ([]byte, error) {
+	if account.SecretEnv != "" {
+		secret := os.Getenv(account.SecretEnv)
+		if secret == "" {
+			return nil, fmt.Errorf("client secret environment variable %v is empty", account.SecretEnv)
+		}
+		return []byte(secret), nil
+	}
+	return filestore.Read(account.secretPath())
+}
+
+// accountClient is the authorized client and API service of an account.
+type accountClient struct {
+	client  *http.Client
+	service *youtube.Service
+	tokens  *storingTokenSource
+}
+
+func newAccountClient(ctx context.Context, account *Account) (*accountClient, error) {
+	// Get config using google client config secret
+	secret, err := account.secret()
+	if err != nil {
+		return nil, err
+	}
+	config, err := google.ConfigFromJSON(secret, youtube_scopes...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get token, refreshed tokens are saved back to the store
+	store := NewTokenStore(account.tokenPath())
+	token, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize authorized client and API service
+	tokens := newStoringTokenSource(config.TokenSource(ctx, token), store, token)
+	client := oauth2.NewClient(ctx, tokens)
+	service, err := youtube.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, err
+	}
+	return &accountClient{client: client, service: service, tokens: tokens}, nil
+}
+
+// account returns the named account, the empty name is the default account
+// configured in the youtube section itself.
+func (youtubeVideos *YoutubeVideos) account(name string) (*Account, error) {
+	if name == "" || name == default_account_name {
+		return &youtubeVideos.Account, nil
+	}
+	account, found := youtubeVideos.Accounts[name]
+	if !found {
+		return nil, fmt.Errorf("unknown youtube account %q", name)
+	}
+	return &account, nil
+}
+
+// accountClient returns the client of the named account, built on first use
+// and shared by every video published to it.
+func (youtubePublisher *youtubePublisher) accountClient(name string) (*accountClient, error) {
+	youtubePublisher.lock.Lock()
+	defer youtubePublisher.lock.Unlock()
+	if name == "" {
+		name = default_account_name
+	}
+	if client, found := youtubePublisher.clients[name]; found {
+		return client, nil
+	}
+	account, err := youtubePublisher.config.account(name)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newAccountClient(context.Background(), account)
+	if err != nil {
+		return nil, fmt.Errorf("youtube account %v: %w", name, err)
+	}
+	log.Printf("Authorized youtube account %v\n", name)
+	youtubePublisher.clients[name] = client
+	return client, nil
+}
@@ -0,0 +1,64 @@
+package videouploader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+const test_client_secret = `{"installed":{"client_id":"client","client_secret":"secret","redirect_uris":["http://localhost"],"auth_uri":"https://accounts.google.com/o/oauth2/auth","token_uri":"https://oauth2.googleapis.com/token"}}`
+
+func TestAccounts(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("ARKSTORM_TEST_DIR", tempDir)
+	t.Setenv("ARKSTORM_TEST_SECRET", test_client_secret)
+	assert.Nil(t, os.WriteFile(filepath.Join(tempDir, "secret.json"), []byte(test_client_secret), 0600))
+	for _, name := range []string{"main", "oregon"} {
+		assert.Nil(t, NewTokenStore(filepath.Join(tempDir, name+"-token.json")).Save(&oauth2.Token{AccessToken: name, RefreshToken: name}))
+	}
+
+	var config YoutubeVideos
+	_, err := toml.Decode(`
+secret = "$ARKSTORM_TEST_DIR/secret.json"
+token = "$ARKSTORM_TEST_DIR/main-token.json"
+
+[accounts.oregon]
+secretenv = "ARKSTORM_TEST_SECRET"
+token = "${ARKSTORM_TEST_DIR}/oregon-token.json"
+
+[accounts.broken]
+secretenv = "ARKSTORM_TEST_MISSING"
+`, &config)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(tempDir, "main-token.json"), config.Account.tokenPath())
+
+	// Clients are built once per account
+	youtubePublisher := NewPublisher(&config).(*youtubePublisher)
+	first, err := youtubePublisher.accountClient("")
+	assert.Nil(t, err)
+	again, err := youtubePublisher.accountClient(default_account_name)
+	assert.Nil(t, err)
+	assert.Same(t, first, again)
+	oregon, err := youtubePublisher.accountClient("oregon")
+	assert.Nil(t, err)
+	assert.NotSame(t, first, oregon)
+	assert.Equal(t, 2, len(youtubePublisher.clients))
+
+	// Missing credentials and unknown accounts
+	_, err = youtubePublisher.accountClient("broken")
+	assert.Contains(t, err.Error(), "ARKSTORM_TEST_MISSING")
+	_, err = youtubePublisher.accountClient("washington")
+	assert.Contains(t, err.Error(), "unknown youtube account")
+
+	// The default account falls back to the working directory files, or the
+	// job's credentials bucket for the token
+	t.Setenv(creds_bucket_env, "")
+	assert.Equal(t, default_client_secret_file, (&Account{}).secretPath())
+	assert.Equal(t, default_client_token_file, (&Account{}).tokenPath())
+	t.Setenv(creds_bucket_env, "s3://creds/washington/")
+	assert.Equal(t, "s3://creds/washington/client_token.json", (&Account{}).tokenPath())
+}
@@ -0,0 +1,95 @@
+package videouploader
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+
+	"github.com/pashonic/arkstorm/src/videobuilder"
+)
+
+const (
+	caption_content_type = "application/octet-stream" // YouTube detects the caption format from the content
+)
+
+var caption_formats = []string{"srt", "vtt"}
+
+type Caption struct {
+	Language string // BCP-47 language of the track, e.g. en or en-US
+	Name     string // Track name shown in the player, empty for the default track
+	File     string // SRT or WebVTT file, defaults to the subtitles from the build for a single caption
+}
+
+func (caption *Caption) validate() error {
+	if caption.Language == "" {
+		return fmt.Errorf("caption: language is required")
+	}
+	if caption.File != "" && !contains(caption_formats, strings.TrimPrefix(filepath.Ext(caption.File), ".")) {
+		return fmt.Errorf("caption: %v isn't an srt or vtt file", caption.File)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// filePath returns the caption file, preferring the build's SRT subtitles.
+func (caption *Caption) filePath(subtitles []videobuilder.OutputSubtitle) (string, error) {
+	if caption.File != "" {
+		return caption.File, nil
+	}
+	for _, format := range caption_formats {
+		for _, subtitle := range subtitles {
+			if subtitle.Format == format {
+				return subtitle.FilePath, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("caption %v: no file configured and the build made no subtitles", caption.Language)
+}
+
+// insertCaptions uploads each caption track, trying them all before
+// reporting the first failure.
+func insertCaptions(service *youtube.Service, videoId string, captions []Caption, subtitles []videobuilder.OutputSubtitle) error {
+	var firstErr error
+	for _, caption := range captions {
+		err := insertCaption(service, videoId, &caption, subtitles)
+		if err != nil {
+			log.Printf("Caption %v for video %v failed: %v\n", caption.Language, videoId, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("caption %v: %w", caption.Language, err)
+			}
+			continue
+		}
+		log.Printf("Added %v caption track to video %v\n", caption.Language, videoId)
+	}
+	return firstErr
+}
+
+func insertCaption(service *youtube.Service, videoId string, caption *Caption, subtitles []videobuilder.OutputSubtitle) error {
+	filePath, err := caption.filePath(subtitles)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	track := &youtube.Caption{
+		Snippet: &youtube.CaptionSnippet{VideoId: videoId, Language: caption.Language, Name: caption.Name},
+	}
+	_, err = service.Captions.Insert([]string{"snippet"}, track).Media(file, googleapi.ContentType(caption_content_type)).Do()
+	return err
+}
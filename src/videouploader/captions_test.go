@@ -0,0 +1,67 @@
+package videouploader
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pashonic/arkstorm/src/videobuilder"
+)
+
+func TestInsertCaptions(t *testing.T) {
+	tempDir := t.TempDir()
+	srtPath := filepath.Join(tempDir, "Winter.srt")
+	vttPath := filepath.Join(tempDir, "Winter.vtt")
+	spanishPath := filepath.Join(tempDir, "Winter.es.srt")
+	for filePath, content := range map[string]string{srtPath: "1\n00:00:00,000 --> 00:00:01,000\nTemp\n", vttPath: "WEBVTT\n", spanishPath: "1\n00:00:00,000 --> 00:00:01,000\nTemperatura\n"} {
+		assert.Nil(t, os.WriteFile(filePath, []byte(content), 0644))
+	}
+
+	var lock sync.Mutex
+	var bodies []string
+	service := newFakeService(t, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		assert.Equal(t, "/upload/youtube/v3/captions", request.URL.Path)
+		body, _ := io.ReadAll(request.Body)
+		bodies = append(bodies, string(body))
+		writer.Write([]byte(`{}`))
+	}))
+
+	// Build subtitles are used unless the caption names a file
+	subtitles := []videobuilder.OutputSubtitle{{Format: "vtt", FilePath: vttPath}, {Format: "srt", FilePath: srtPath}}
+	captions := []Caption{{Language: "en", Name: "Forecast"}, {Language: "es", File: spanishPath}}
+	assert.Nil(t, insertCaptions(service, "abc123", captions, subtitles))
+	assert.Equal(t, 2, len(bodies))
+	assert.Contains(t, bodies[0], `"language":"en"`)
+	assert.Contains(t, bodies[0], `"name":"Forecast"`)
+	assert.Contains(t, bodies[0], `"videoId":"abc123"`)
+	assert.Contains(t, bodies[0], "\nTemp\n")
+	assert.Contains(t, bodies[1], `"language":"es"`)
+	assert.Contains(t, bodies[1], "Temperatura")
+
+	// A missing file fails its track, the rest still upload
+	err := insertCaptions(service, "abc123", []Caption{{Language: "fr", File: filepath.Join(tempDir, "missing.srt")}, {Language: "en"}}, subtitles)
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "caption fr"))
+	assert.Equal(t, 3, len(bodies))
+	assert.NotNil(t, insertCaptions(service, "abc123", []Caption{{Language: "en"}}, nil))
+}
+
+func TestCaptionValidate(t *testing.T) {
+	assert.Nil(t, (&Caption{Language: "en", File: "captions.vtt"}).validate())
+	assert.NotNil(t, (&Caption{File: "captions.srt"}).validate())
+	assert.NotNil(t, (&Caption{Language: "en", File: "captions.ass"}).validate())
+
+	// Only one track can carry the build subtitles
+	video := &YoutubeVideo{Captions: []Caption{{Language: "en"}, {Language: "es", File: "captions.es.srt"}}}
+	assert.Nil(t, video.validate())
+	video.Captions[1].File = ""
+	assert.Contains(t, video.validate().Error(), "set file for the other languages")
+}
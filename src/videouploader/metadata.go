@@ -0,0 +1,174 @@
+package videouploader
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pashonic/arkstorm/src/videobuilder"
+)
+
+const (
+	default_metadata_timezone = "UTC"
+	max_title_length          = 100  // Characters
+	max_description_bytes     = 5000 // Bytes
+	run_id_layout             = "2006010215"
+	upload_run_id_layout      = "20060102-150405"
+)
+
+// metadataClip is a clip as seen by the title, description and tag templates.
+type metadataClip struct {
+	Name       string
+	View       string
+	Start      float64 // Seconds into the video
+	Duration   float64
+	Init       time.Time
+	ValidStart time.Time
+	ValidEnd   time.Time
+}
+
+// metadataData is the data the title, description and tag templates render.
+// Times are in the video timezone, and zero when the clips have no frame
+// metadata.
+type metadataData struct {
+	VideoId    string
+	RunId      string // Cycle init as YYYYMMDDHH, or the upload time without frame metadata
+	Init       time.Time
+	ValidStart time.Time
+	ValidEnd   time.Time
+	Duration   float64
+	Clips      []metadataClip
+}
+
+// uploadMetadata is the rendered title, description and tags.
+type uploadMetadata struct {
+	Title       string
+	Description string
+	Tags        []string
+}
+
+func newMetadataData(videoId string, video *videobuilder.OutputVideo, location *time.Location, now time.Time) metadataData {
+	data := metadataData{VideoId: videoId, Duration: video.DurationSec}
+	if !video.InitTime.IsZero() {
+		data.Init = video.InitTime.In(location)
+		data.RunId = video.InitTime.UTC().Format(run_id_layout)
+	} else {
+		data.RunId = now.UTC().Format(upload_run_id_layout)
+	}
+	for _, clip := range video.Clips {
+		data.Clips = append(data.Clips, metadataClip{
+			Name:       clip.Name,
+			View:       clip.View,
+			Start:      clip.StartTimeSec,
+			Duration:   clip.DurationSec,
+			Init:       inLocation(clip.InitTime, location),
+			ValidStart: inLocation(clip.ValidStart, location),
+			ValidEnd:   inLocation(clip.ValidEnd, location),
+		})
+		if !clip.ValidStart.IsZero() && (data.ValidStart.IsZero() || clip.ValidStart.Before(data.ValidStart)) {
+			data.ValidStart = clip.ValidStart.In(location)
+		}
+		if clip.ValidEnd.After(data.ValidEnd) {
+			data.ValidEnd = clip.ValidEnd.In(location)
+		}
+	}
+	return data
+}
+
+func inLocation(t time.Time, location *time.Location) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(location)
+}
+
+// chapterList returns the YouTube chapter lines for the clips.
+func chapterList(clips []videobuilder.OutputClip) string {
+	var builder strings.Builder
+	for _, clip := range clips {
+		fmt.Fprintf(&builder, "%v %v\n", secondsToMinutes(clip.StartTimeSec), clip.Name)
+	}
+	return builder.String()
+}
+
+// renderMetadata renders the title, description and tags templates. The
+// chapter list is appended to the description unless the template places it
+// with the chapters function.
+func renderMetadata(videoId string, video *videobuilder.OutputVideo, youtubeVideo *YoutubeVideo, now time.Time) (*uploadMetadata, error) {
+	timezone := youtubeVideo.Timezone
+	if timezone == "" {
+		timezone = default_metadata_timezone
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	data := newMetadataData(videoId, video, location, now)
+	chaptersUsed := false
+	funcs := template.FuncMap{
+		"chapters": func() string {
+			chaptersUsed = true
+			return chapterList(video.Clips)
+		},
+		"format": func(layout string, t time.Time) string { return t.Format(layout) },
+		"in": func(timezone string, t time.Time) (time.Time, error) {
+			location, err := time.LoadLocation(timezone)
+			if err != nil {
+				return t, err
+			}
+			return t.In(location), nil
+		},
+		"addHours": func(hours int, t time.Time) time.Time { return t.Add(time.Duration(hours) * time.Hour) },
+		"cycle":    func(t time.Time) string { return t.UTC().Format("15") + "z" },
+		"hours":    func(from time.Time, to time.Time) int { return int(to.Sub(from).Hours()) },
+		"join":     strings.Join,
+	}
+	render := func(name string, text string) (string, error) {
+		parsed, err := template.New(name).Funcs(funcs).Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("invalid %v template: %w", name, err)
+		}
+		var builder strings.Builder
+		if err := parsed.Execute(&builder, data); err != nil {
+			return "", fmt.Errorf("%v template: %w", name, err)
+		}
+		return strings.TrimSpace(builder.String()), nil
+	}
+
+	// Title
+	metadata := &uploadMetadata{}
+	if metadata.Title, err = render("title", youtubeVideo.Title); err != nil {
+		return nil, err
+	}
+	if metadata.Title == "" {
+		return nil, fmt.Errorf("title template rendered an empty title")
+	}
+	if length := utf8.RuneCountInString(metadata.Title); length > max_title_length {
+		return nil, fmt.Errorf("title %q is %v characters, YouTube allows %v", metadata.Title, length, max_title_length)
+	}
+
+	// Description
+	if metadata.Description, err = render("description", youtubeVideo.Description); err != nil {
+		return nil, err
+	}
+	if !chaptersUsed {
+		metadata.Description += "\n\n" + chapterList(video.Clips)
+	}
+	if len(metadata.Description) > max_description_bytes {
+		return nil, fmt.Errorf("description is %v bytes, YouTube allows %v", len(metadata.Description), max_description_bytes)
+	}
+
+	// Tags, dropping any that render empty
+	for _, tag := range youtubeVideo.Tags {
+		rendered, err := render("tag", tag)
+		if err != nil {
+			return nil, err
+		}
+		if rendered != "" {
+			metadata.Tags = append(metadata.Tags, rendered)
+		}
+	}
+	return metadata, nil
+}
@@ -0,0 +1,56 @@
+package videouploader
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pashonic/arkstorm/src/videobuilder"
+)
+
+func testOutputVideo() *videobuilder.OutputVideo {
+	initTime := time.Date(2023, 2, 3, 12, 0, 0, 0, time.UTC)
+	return &videobuilder.OutputVideo{
+		DurationSec: 75,
+		InitTime:    initTime,
+		Clips: []videobuilder.OutputClip{
+			{Name: "2m Temp", View: "temp", StartTimeSec: 0, DurationSec: 30, InitTime: initTime, ValidStart: initTime, ValidEnd: initTime.Add(72 * time.Hour)},
+			{Name: "Snow", View: "snow", StartTimeSec: 30, DurationSec: 45, InitTime: initTime, ValidStart: initTime.Add(6 * time.Hour), ValidEnd: initTime.Add(96 * time.Hour)},
+		},
+	}
+}
+
+func TestRenderMetadata(t *testing.T) {
+	now := time.Date(2023, 2, 3, 20, 0, 0, 0, time.UTC)
+	youtubeVideo := &YoutubeVideo{
+		Title:       `ECMWF Washington {{hours .ValidStart .ValidEnd}}h Forecast {{format "Jan 2 3PM MST" .Init}} ({{cycle .Init}})`,
+		Description: "Run {{.RunId}}\n{{chapters}}\n{{range .Clips}}{{.View}}: {{format \"Mon 15:04\" .ValidEnd}}\n{{end}}",
+		Timezone:    "America/Los_Angeles",
+		Tags:        []string{"washington", "{{.RunId}}", "{{if .Clips}}{{end}}"},
+	}
+	metadata, err := renderMetadata("winter", testOutputVideo(), youtubeVideo, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "ECMWF Washington 96h Forecast Feb 3 4AM PST (12z)", metadata.Title)
+	assert.Equal(t, "Run 2023020312\n0:00 2m Temp\n0:30 Snow\n\ntemp: Mon 04:00\nsnow: Tue 04:00", metadata.Description)
+	assert.Equal(t, []string{"washington", "2023020312"}, metadata.Tags)
+
+	// Plain text still gets the chapters appended
+	metadata, err = renderMetadata("winter", testOutputVideo(), &YoutubeVideo{Title: "Winter", Description: "72 hours out"}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "72 hours out\n\n0:00 2m Temp\n0:30 Snow\n", metadata.Description)
+
+	// Without frame metadata the run ID comes from the upload time
+	metadata, err = renderMetadata("winter", &videobuilder.OutputVideo{}, &YoutubeVideo{Title: "{{.VideoId}} {{.RunId}}"}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "winter 20230203-200000", metadata.Title)
+
+	// Broken templates and titles YouTube would reject
+	_, err = renderMetadata("winter", testOutputVideo(), &YoutubeVideo{Title: "{{.Missing}}"}, now)
+	assert.NotNil(t, err)
+	_, err = renderMetadata("winter", testOutputVideo(), &YoutubeVideo{Title: strings.Repeat("a", 101)}, now)
+	assert.NotNil(t, err)
+	_, err = renderMetadata("winter", testOutputVideo(), &YoutubeVideo{Title: "{{if false}}x{{end}}"}, now)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,89 @@
+package videouploader
+
+import (
+	"fmt"
+	"log"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	playlist_page_size       = 50
+	youtube_video_kind       = "youtube#video"
+	default_playlist_privacy = "private"
+)
+
+// playlistIds returns the IDs of every playlist the video belongs in,
+// creating the titled playlists the channel doesn't have yet.
+func playlistIds(service *youtube.Service, youtubeVideo *YoutubeVideo) ([]string, error) {
+	ids := append([]string{}, youtubeVideo.PlaylistIds...)
+	if len(youtubeVideo.Playlists) == 0 {
+		return ids, nil
+	}
+
+	// Find the channel playlists by title
+	existing := map[string]string{}
+	err := service.Playlists.List([]string{"snippet"}).Mine(true).MaxResults(playlist_page_size).Pages(nil, func(response *youtube.PlaylistListResponse) error {
+		for _, playlist := range response.Items {
+			if _, found := existing[playlist.Snippet.Title]; !found {
+				existing[playlist.Snippet.Title] = playlist.Id
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing playlists: %w", err)
+	}
+
+	// Create the missing ones with the video privacy
+	privacy := youtubeVideo.Privacy
+	if privacy == "" {
+		privacy = default_playlist_privacy
+	}
+	for _, title := range youtubeVideo.Playlists {
+		if id, found := existing[title]; found {
+			ids = append(ids, id)
+			continue
+		}
+		playlist, err := service.Playlists.Insert([]string{"snippet", "status"}, &youtube.Playlist{
+			Snippet: &youtube.PlaylistSnippet{Title: title},
+			Status:  &youtube.PlaylistStatus{PrivacyStatus: privacy},
+		}).Do()
+		if err != nil {
+			return nil, fmt.Errorf("creating playlist %q: %w", title, err)
+		}
+		log.Printf("Created playlist %q: %v\n", title, playlist.Id)
+		existing[title] = playlist.Id
+		ids = append(ids, playlist.Id)
+	}
+	return ids, nil
+}
+
+// addToPlaylists inserts the video at the top of each playlist, trying them
+// all before reporting the first failure.
+func addToPlaylists(service *youtube.Service, videoId string, youtubeVideo *YoutubeVideo) error {
+	ids, err := playlistIds(service, youtubeVideo)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, playlistId := range ids {
+		item := &youtube.PlaylistItem{
+			Snippet: &youtube.PlaylistItemSnippet{
+				PlaylistId:      playlistId,
+				Position:        0,
+				ResourceId:      &youtube.ResourceId{Kind: youtube_video_kind, VideoId: videoId},
+				ForceSendFields: []string{"Position"}, // Zero is omitted otherwise, which appends to the end
+			},
+		}
+		if _, err := service.PlaylistItems.Insert([]string{"snippet"}, item).Do(); err != nil {
+			log.Printf("Adding video %v to playlist %v failed: %v\n", videoId, playlistId, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("adding to playlist %v: %w", playlistId, err)
+			}
+			continue
+		}
+		log.Printf("Added video %v to playlist %v\n", videoId, playlistId)
+	}
+	return firstErr
+}
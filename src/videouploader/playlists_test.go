@@ -0,0 +1,89 @@
+package videouploader
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+// fakePlaylistServer serves the playlist endpoints of the YouTube Data API.
+type fakePlaylistServer struct {
+	lock      sync.Mutex
+	playlists []*youtube.Playlist
+	items     []*youtube.PlaylistItem
+}
+
+func (server *fakePlaylistServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	switch {
+	case request.URL.Path == "/youtube/v3/playlists" && request.Method == http.MethodGet:
+		// Page one playlist at a time to exercise paging
+		index := 0
+		if token := request.URL.Query().Get("pageToken"); token != "" {
+			json.Unmarshal([]byte(token), &index)
+		}
+		response := &youtube.PlaylistListResponse{Items: server.playlists[index : index+1]}
+		if index+1 < len(server.playlists) {
+			next, _ := json.Marshal(index + 1)
+			response.NextPageToken = string(next)
+		}
+		json.NewEncoder(writer).Encode(response)
+	case request.URL.Path == "/youtube/v3/playlists":
+		playlist := &youtube.Playlist{}
+		json.NewDecoder(request.Body).Decode(playlist)
+		playlist.Id = "PLnew"
+		server.playlists = append(server.playlists, playlist)
+		json.NewEncoder(writer).Encode(playlist)
+	case request.URL.Path == "/youtube/v3/playlistItems":
+		data, _ := io.ReadAll(request.Body)
+		var raw map[string]map[string]interface{}
+		json.Unmarshal(data, &raw)
+		item := &youtube.PlaylistItem{}
+		json.Unmarshal(data, item)
+		if _, sent := raw["snippet"]["position"]; !sent {
+			http.Error(writer, "position missing", http.StatusBadRequest)
+			return
+		}
+		server.items = append(server.items, item)
+		json.NewEncoder(writer).Encode(item)
+	default:
+		http.NotFound(writer, request)
+	}
+}
+
+func TestAddToPlaylists(t *testing.T) {
+	fake := &fakePlaylistServer{playlists: []*youtube.Playlist{
+		{Id: "PLwinter", Snippet: &youtube.PlaylistSnippet{Title: "Winter"}},
+		{Id: "PLsummer", Snippet: &youtube.PlaylistSnippet{Title: "Summer"}},
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	service, err := youtube.NewService(context.Background(), option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL+"/"))
+	assert.Nil(t, err)
+
+	youtubeVideo := &YoutubeVideo{Privacy: "unlisted", PlaylistIds: []string{"PLfixed"}, Playlists: []string{"Summer", "Washington"}}
+	assert.Nil(t, addToPlaylists(service, "abc123", youtubeVideo))
+
+	// Missing titles are created with the video privacy
+	assert.Equal(t, 3, len(fake.playlists))
+	assert.Equal(t, "Washington", fake.playlists[2].Snippet.Title)
+	assert.Equal(t, "unlisted", fake.playlists[2].Status.PrivacyStatus)
+
+	// The video goes to the top of every playlist
+	var playlistIds []string
+	for _, item := range fake.items {
+		playlistIds = append(playlistIds, item.Snippet.PlaylistId)
+		assert.Equal(t, int64(0), item.Snippet.Position)
+		assert.Equal(t, "abc123", item.Snippet.ResourceId.VideoId)
+	}
+	assert.Equal(t, []string{"PLfixed", "PLsummer", "PLnew"}, playlistIds)
+}
@@ -0,0 +1,252 @@
+package videouploader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	default_upload_endpoint   = "https://www.googleapis.com/upload/youtube/v3/videos?uploadType=resumable&part=snippet,status"
+	default_chunk_size_mb     = 8
+	default_upload_retries    = 5
+	default_upload_backoff    = 2 * time.Second
+	max_upload_backoff        = 64 * time.Second
+	upload_chunk_granularity  = 256 * 1024 // Chunks must be multiples of 256 KiB, except the last
+	status_resume_incomplete  = 308
+	upload_content_type       = "video/*"
+	upload_metadata_mime_type = "application/json; charset=UTF-8"
+)
+
+type UploadSettings struct {
+	ChunkSizeMb int // Size of each upload request, rounded down to 256 KiB
+	Retries     int // Attempts per chunk before the upload fails
+	BackoffSec  int // Wait before the first retry, doubled on each retry
+}
+
+type resumableUploader struct {
+	client     *http.Client
+	endpoint   string
+	chunkSize  int64
+	maxRetries int
+	backoff    time.Duration
+	sleep      func(time.Duration)
+}
+
+func newResumableUploader(client *http.Client, settings *UploadSettings) *resumableUploader {
+	uploader := &resumableUploader{
+		client:     client,
+		endpoint:   default_upload_endpoint,
+		chunkSize:  default_chunk_size_mb * 1024 * 1024,
+		maxRetries: default_upload_retries,
+		backoff:    default_upload_backoff,
+		sleep:      time.Sleep,
+	}
+	if settings.ChunkSizeMb > 0 {
+		uploader.chunkSize = int64(settings.ChunkSizeMb) * 1024 * 1024
+	}
+	if settings.Retries > 0 {
+		uploader.maxRetries = settings.Retries
+	}
+	if settings.BackoffSec > 0 {
+		uploader.backoff = time.Duration(settings.BackoffSec) * time.Second
+	}
+	return uploader
+}
+
+// uploadError is a response that retrying won't fix.
+type uploadError struct {
+	status int
+	body   string
+}
+
+func (err *uploadError) Error() string {
+	return fmt.Sprintf("upload rejected with status %v: %v", err.status, err.body)
+}
+
+// upload sends the video metadata to start a session, then the file in
+// chunks. Failed chunks are retried with backoff from the offset the server
+// reports it has received, an expired session is started again.
+func (uploader *resumableUploader) upload(metadata *youtube.Video, file io.ReaderAt, size int64) (*youtube.Video, error) {
+	sessionUrl, err := uploader.startSession(metadata, size)
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := uploader.chunkSize - uploader.chunkSize%upload_chunk_granularity
+	if chunkSize <= 0 {
+		chunkSize = upload_chunk_granularity
+	}
+
+	// Send chunks until the server has the whole file
+	var offset int64
+	attempt := 0
+	for {
+		end := offset + chunkSize
+		if end > size {
+			end = size
+		}
+		video, received, err := uploader.sendChunk(sessionUrl, io.NewSectionReader(file, offset, end-offset), offset, end, size)
+		if video != nil {
+			return video, nil
+		}
+		if err == nil && received > offset { // Progress earns a fresh set of retries
+			offset, attempt = received, 0
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("server kept %v bytes after the chunk ending at byte %v", received, end)
+		}
+
+		// Back off, then ask the server where to resume from
+		for {
+			expired := sessionExpired(err)
+			var rejected *uploadError
+			if !expired && errors.As(err, &rejected) {
+				return nil, err
+			}
+			attempt++
+			if attempt > uploader.maxRetries {
+				return nil, fmt.Errorf("upload failed at byte %v of %v after %v retries: %w", offset, size, uploader.maxRetries, err)
+			}
+			wait := uploader.backoff << (attempt - 1)
+			if wait > max_upload_backoff {
+				wait = max_upload_backoff
+			}
+			log.Printf("Upload chunk at byte %v failed, retrying in %v: %v\n", offset, wait, err)
+			uploader.sleep(wait)
+
+			// An expired session can't be resumed, the upload starts over
+			if expired {
+				log.Printf("Upload session expired, starting a new one\n")
+				if sessionUrl, err = uploader.startSession(metadata, size); err == nil {
+					offset = 0
+					break
+				}
+				continue
+			}
+			video, received, err = uploader.queryStatus(sessionUrl, size)
+			if video != nil {
+				return video, nil
+			}
+			if err == nil {
+				if received > offset {
+					attempt = 0
+				}
+				offset = received
+				break
+			}
+		}
+	}
+}
+
+// sessionExpired reports whether the upload session is gone, which
+// happens about a week after it was started.
+func sessionExpired(err error) bool {
+	var rejected *uploadError
+	return errors.As(err, &rejected) && (rejected.status == http.StatusNotFound || rejected.status == http.StatusGone)
+}
+
+func (uploader *resumableUploader) startSession(metadata *youtube.Video, size int64) (string, error) {
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	request, err := http.NewRequest(http.MethodPost, uploader.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", upload_metadata_mime_type)
+	request.Header.Set("X-Upload-Content-Type", upload_content_type)
+	request.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	response, err := uploader.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(response.Body)
+		return "", &uploadError{status: response.StatusCode, body: strings.TrimSpace(string(responseBody))}
+	}
+	sessionUrl := response.Header.Get("Location")
+	if sessionUrl == "" {
+		return "", fmt.Errorf("upload session response has no location")
+	}
+	return sessionUrl, nil
+}
+
+func (uploader *resumableUploader) sendChunk(sessionUrl string, chunk io.Reader, start int64, end int64, size int64) (*youtube.Video, int64, error) {
+	request, err := http.NewRequest(http.MethodPut, sessionUrl, chunk)
+	if err != nil {
+		return nil, 0, err
+	}
+	request.ContentLength = end - start
+	request.Header.Set("Content-Type", upload_content_type)
+	request.Header.Set("Content-Range", fmt.Sprintf("bytes %v-%v/%v", start, end-1, size))
+	return uploader.do(request)
+}
+
+// queryStatus asks the server how much of the file it has.
+func (uploader *resumableUploader) queryStatus(sessionUrl string, size int64) (*youtube.Video, int64, error) {
+	request, err := http.NewRequest(http.MethodPut, sessionUrl, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	request.ContentLength = 0
+	request.Header.Set("Content-Range", fmt.Sprintf("bytes */%v", size))
+	return uploader.do(request)
+}
+
+// do sends a session request and returns the finished video, or the offset
+// the server expects next.
+func (uploader *resumableUploader) do(request *http.Request) (*youtube.Video, int64, error) {
+	response, err := uploader.client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case response.StatusCode == http.StatusOK || response.StatusCode == http.StatusCreated:
+		video := &youtube.Video{}
+		if err := json.Unmarshal(body, video); err != nil {
+			return nil, 0, err
+		}
+		return video, 0, nil
+	case response.StatusCode == status_resume_incomplete:
+		received, err := parseReceivedRange(response.Header.Get("Range"))
+		return nil, received, err
+	case response.StatusCode >= 500:
+		return nil, 0, fmt.Errorf("upload server error %v: %v", response.StatusCode, strings.TrimSpace(string(body)))
+	default:
+		return nil, 0, &uploadError{status: response.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+}
+
+// parseReceivedRange returns the next offset from a "bytes=0-N" range,
+// a missing range means nothing has been received yet.
+func parseReceivedRange(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+	_, last, found := strings.Cut(strings.TrimPrefix(header, "bytes="), "-")
+	if !found {
+		return 0, fmt.Errorf("invalid upload range %q", header)
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid upload range %q", header)
+	}
+	return end + 1, nil
+}
@@ -0,0 +1,194 @@
+package videouploader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/youtube/v3"
+)
+
+// fakeUploadServer implements the resumable upload protocol and fails the
+// chunk requests listed in failures.
+type fakeUploadServer struct {
+	lock     sync.Mutex
+	size     int64
+	title    string
+	received []byte
+	chunks   int
+	sessions int
+	failures map[int]string // Chunk number to "partial", "drop", "stall", "norange" or an HTTP status
+}
+
+func (server *fakeUploadServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	// Start session
+	if request.Method == http.MethodPost {
+		var metadata youtube.Video
+		json.NewDecoder(request.Body).Decode(&metadata)
+		server.title = metadata.Snippet.Title
+		fmt.Sscan(request.Header.Get("X-Upload-Content-Length"), &server.size)
+		server.received = nil
+		server.sessions++
+		writer.Header().Set("Location", "http://"+request.Host+"/session")
+		return
+	}
+
+	// Status query
+	contentRange := request.Header.Get("Content-Range")
+	if strings.HasPrefix(contentRange, "bytes */") {
+		server.respondProgress(writer)
+		return
+	}
+
+	// Chunk
+	server.chunks++
+	var start, end, total int64
+	fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total)
+	if start != int64(len(server.received)) {
+		http.Error(writer, "chunk doesn't continue the upload", http.StatusBadRequest)
+		return
+	}
+	data, _ := io.ReadAll(request.Body)
+	switch failure := server.failures[server.chunks]; failure {
+	case "partial": // Keep half the chunk, then fail
+		server.received = append(server.received, data[:len(data)/2]...)
+		http.Error(writer, "backend error", http.StatusServiceUnavailable)
+		return
+	case "drop":
+		connection, _, _ := writer.(http.Hijacker).Hijack()
+		connection.Close()
+		return
+	case "stall": // Acknowledge without keeping the chunk
+		server.respondProgress(writer)
+		return
+	case "norange":
+		writer.WriteHeader(status_resume_incomplete)
+		return
+	case "":
+	default:
+		var status int
+		fmt.Sscan(failure, &status)
+		http.Error(writer, "failure", status)
+		return
+	}
+	server.received = append(server.received, data...)
+	server.respondProgress(writer)
+}
+
+func (server *fakeUploadServer) respondProgress(writer http.ResponseWriter) {
+	if int64(len(server.received)) == server.size {
+		json.NewEncoder(writer).Encode(&youtube.Video{Id: "abc123"})
+		return
+	}
+	if len(server.received) > 0 {
+		writer.Header().Set("Range", fmt.Sprintf("bytes=0-%v", len(server.received)-1))
+	}
+	writer.WriteHeader(status_resume_incomplete)
+}
+
+func runUpload(t *testing.T, fake *fakeUploadServer, data []byte) (*youtube.Video, []time.Duration, error) {
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	uploader := newResumableUploader(server.Client(), &UploadSettings{Retries: 3, BackoffSec: 1})
+	uploader.endpoint = server.URL + "/upload"
+	uploader.chunkSize = upload_chunk_granularity
+	var waits []time.Duration
+	uploader.sleep = func(wait time.Duration) { waits = append(waits, wait) }
+	metadata := &youtube.Video{Snippet: &youtube.VideoSnippet{Title: "Winter"}}
+	video, err := uploader.upload(metadata, bytes.NewReader(data), int64(len(data)))
+	return video, waits, err
+}
+
+func testData() []byte {
+	data := make([]byte, upload_chunk_granularity*2+1000)
+	for index := range data {
+		data[index] = byte(index % 251)
+	}
+	return data
+}
+
+func TestResumableUpload(t *testing.T) {
+	data := testData()
+	fake := &fakeUploadServer{failures: map[int]string{2: "partial", 3: "drop"}}
+	video, waits, err := runUpload(t, fake, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123", video.Id)
+	assert.Equal(t, "Winter", fake.title)
+	assert.True(t, bytes.Equal(data, fake.received))
+
+	// Each failure waits the first backoff, progress resets the retries
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, waits)
+}
+
+func TestResumableUploadRetriesExhausted(t *testing.T) {
+	failures := map[int]string{}
+	for chunk := 2; chunk < 10; chunk++ {
+		failures[chunk] = "503"
+	}
+	_, waits, err := runUpload(t, &fakeUploadServer{failures: failures}, testData())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "after 3 retries")
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, waits)
+}
+
+func TestResumableUploadNoProgress(t *testing.T) {
+
+	// Acknowledged chunks that aren't kept are retried with backoff
+	failures := map[int]string{}
+	for chunk := 2; chunk < 10; chunk++ {
+		failures[chunk] = "stall"
+	}
+	_, waits, err := runUpload(t, &fakeUploadServer{failures: failures}, testData())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "after 3 retries")
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, waits)
+
+	// A response without a range doesn't restart the upload from the start
+	data := testData()
+	fake := &fakeUploadServer{failures: map[int]string{2: "norange"}}
+	video, waits, err := runUpload(t, fake, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123", video.Id)
+	assert.True(t, bytes.Equal(data, fake.received))
+	assert.Equal(t, []time.Duration{time.Second}, waits)
+}
+
+func TestResumableUploadSessionExpired(t *testing.T) {
+	data := testData()
+	fake := &fakeUploadServer{failures: map[int]string{2: "410"}}
+	video, waits, err := runUpload(t, fake, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123", video.Id)
+	assert.Equal(t, 2, fake.sessions)
+	assert.True(t, bytes.Equal(data, fake.received))
+	assert.Equal(t, []time.Duration{time.Second}, waits)
+}
+
+func TestResumableUploadRejected(t *testing.T) {
+	_, waits, err := runUpload(t, &fakeUploadServer{failures: map[int]string{1: "403"}}, testData())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 403")
+	assert.Empty(t, waits)
+}
+
+func TestParseReceivedRange(t *testing.T) {
+	received, err := parseReceivedRange("bytes=0-524287")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(524288), received)
+	received, err = parseReceivedRange("")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), received)
+	_, err = parseReceivedRange("bytes=nope")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,200 @@
+package videouploader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+
+	"github.com/pashonic/arkstorm/src/utils/filestore"
+)
+
+const (
+	default_ledger_file = "youtube-ledger.json"
+	retire_unlist       = "unlist"
+	retire_private      = "private"
+	retire_delete       = "delete"
+)
+
+var retire_actions = []string{retire_unlist, retire_private, retire_delete}
+
+type Retire struct {
+	Action string // unlist, private or delete
+	Keep   int    // Earlier uploads left untouched, newest first
+	Series string // Ledger series the upload belongs to, defaults to the video ID
+	Ledger string // Ledger file, local path or s3://bucket/key with $VAR expanded, defaults to youtube-ledger.json
+}
+
+// ledgerPath returns the ledger location. Unset variables fail instead of
+// expanding to nothing, which would put the ledger at the filesystem root.
+func (retire *Retire) ledgerPath() (string, error) {
+	if retire.Ledger == "" {
+		return default_ledger_file, nil
+	}
+	var missing []string
+	path := os.Expand(retire.Ledger, func(name string) string {
+		value := os.Getenv(name)
+		if value == "" {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("retire: ledger %v uses unset environment variables %v", retire.Ledger, strings.Join(missing, ", "))
+	}
+	return path, nil
+}
+
+func (retire *Retire) validate() error {
+	if !contains(retire_actions, retire.Action) {
+		return fmt.Errorf("retire: unsupported action %q", retire.Action)
+	}
+	if retire.Keep < 0 {
+		return fmt.Errorf("retire: keep can't be negative")
+	}
+	_, err := retire.ledgerPath()
+	return err
+}
+
+// ledgerEntry is an upload of a series, Retired holds the action once it
+// has been taken.
+type ledgerEntry struct {
+	Id        string
+	Uploaded  time.Time
+	PublishAt *time.Time `json:",omitempty"` // Scheduled publish time, nil when published on upload
+	Retired   string     `json:",omitempty"`
+}
+
+// live reports whether the upload has been published by now.
+func (entry *ledgerEntry) live(now time.Time) bool {
+	return entry.PublishAt == nil || !entry.PublishAt.After(now)
+}
+
+// ledger maps series names to their uploads, oldest first.
+type ledger map[string][]ledgerEntry
+
+func readLedger(path string) (ledger, error) {
+	data, err := filestore.Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := ledger{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("ledger %v: %w", path, err)
+	}
+	return entries, nil
+}
+
+func writeLedger(path string, entries ledger) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return filestore.Write(path, data, 0644)
+}
+
+// retirable returns the indexes of the series entries to retire once the
+// newest entry is added, all active entries except the newest and the Keep
+// before it. An upload is never retired before a newer one is live, so a
+// scheduled upload leaves the current one up until its publish time.
+func retirable(entries []ledgerEntry, keep int, now time.Time) []int {
+	var indexes []int
+	kept := 0
+	liveNewer := len(entries) > 0 && entries[len(entries)-1].live(now)
+	for index := len(entries) - 2; index >= 0; index-- {
+		entry := &entries[index]
+		if entry.Retired != "" {
+			continue
+		}
+		if kept < keep || !liveNewer {
+			kept++
+		} else {
+			indexes = append(indexes, index)
+		}
+		liveNewer = liveNewer || entry.live(now)
+	}
+	return indexes
+}
+
+// retirePrevious records the new upload in the series ledger, then applies
+// the retire action to the earlier uploads that fall outside Keep. The
+// ledger is saved even when some retirements fail so they are retried on
+// the next run. Uploads held back for a scheduled one are retired by the
+// first run after it is live.
+func retirePrevious(service *youtube.Service, seriesId string, videoId string, publishAt *time.Time, retire *Retire, now time.Time) error {
+	path, err := retire.ledgerPath()
+	if err != nil {
+		return err
+	}
+	entries, err := readLedger(path)
+	if err != nil {
+		return err
+	}
+	series := retire.Series
+	if series == "" {
+		series = seriesId
+	}
+	entries[series] = append(entries[series], ledgerEntry{Id: videoId, Uploaded: now.UTC(), PublishAt: publishAt})
+
+	// Retire older uploads
+	var firstErr error
+	for _, index := range retirable(entries[series], retire.Keep, now) {
+		entry := &entries[series][index]
+		if err := retireVideo(service, entry.Id, retire.Action); err != nil {
+			log.Printf("Retiring video %v failed: %v\n", entry.Id, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("retiring video %v: %w", entry.Id, err)
+			}
+			continue
+		}
+		log.Printf("Retired video %v (%v)\n", entry.Id, retire.Action)
+		entry.Retired = retire.Action
+	}
+	if err := writeLedger(path, entries); err != nil {
+		return fmt.Errorf("saving ledger %v, upload %v won't be retired by later runs: %w", path, videoId, err)
+	}
+	return firstErr
+}
+
+// retireVideo applies the action to an upload, videos already removed from
+// the channel count as retired.
+func retireVideo(service *youtube.Service, videoId string, action string) error {
+	if action == retire_delete {
+		err := service.Videos.Delete(videoId).Do()
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	// Keep the rest of the status as it is
+	response, err := service.Videos.List([]string{"status"}).Id(videoId).Do()
+	if err != nil {
+		return err
+	}
+	if len(response.Items) == 0 {
+		return nil
+	}
+	video := response.Items[0]
+	video.Status.PrivacyStatus = "unlisted"
+	if action == retire_private {
+		video.Status.PrivacyStatus = "private"
+	}
+	_, err = service.Videos.Update([]string{"status"}, &youtube.Video{Id: videoId, Status: video.Status}).Do()
+	return err
+}
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
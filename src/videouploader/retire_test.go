@@ -0,0 +1,148 @@
+package videouploader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+// fakeVideoServer serves the video endpoints of the YouTube Data API.
+type fakeVideoServer struct {
+	lock    sync.Mutex
+	privacy map[string]string
+	deleted []string
+}
+
+func (server *fakeVideoServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	id := request.URL.Query().Get("id")
+	switch request.Method {
+	case http.MethodGet:
+		response := &youtube.VideoListResponse{}
+		if privacy, found := server.privacy[id]; found {
+			response.Items = append(response.Items, &youtube.Video{Id: id, Status: &youtube.VideoStatus{PrivacyStatus: privacy, Embeddable: true}})
+		}
+		json.NewEncoder(writer).Encode(response)
+	case http.MethodPut:
+		video := &youtube.Video{}
+		json.NewDecoder(request.Body).Decode(video)
+		server.privacy[video.Id] = video.Status.PrivacyStatus
+		json.NewEncoder(writer).Encode(video)
+	case http.MethodDelete:
+		if _, found := server.privacy[id]; !found {
+			http.Error(writer, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+			return
+		}
+		delete(server.privacy, id)
+		server.deleted = append(server.deleted, id)
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newFakeService(t *testing.T, handler http.Handler) *youtube.Service {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	service, err := youtube.NewService(context.Background(), option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL+"/"))
+	assert.Nil(t, err)
+	return service
+}
+
+func TestRetirable(t *testing.T) {
+	entries := []ledgerEntry{{Id: "a"}, {Id: "b", Retired: "unlist"}, {Id: "c"}, {Id: "d"}, {Id: "new"}}
+	now := time.Now()
+	assert.Equal(t, []int{3, 2, 0}, retirable(entries, 0, now))
+	assert.Equal(t, []int{2, 0}, retirable(entries, 1, now))
+	assert.Empty(t, retirable(entries, 3, now))
+	assert.Empty(t, retirable(entries[4:], 0, now))
+
+	// Nothing before the newest live upload is retired while newer ones wait
+	later := now.Add(time.Hour)
+	entries = []ledgerEntry{{Id: "a"}, {Id: "b"}, {Id: "c", PublishAt: &later}, {Id: "new", PublishAt: &later}}
+	assert.Equal(t, []int{0}, retirable(entries, 0, now))
+	assert.Equal(t, []int{2, 1, 0}, retirable(entries, 0, later))
+}
+
+func TestRetirePrevious(t *testing.T) {
+	fake := &fakeVideoServer{privacy: map[string]string{"v1": "unlisted", "v2": "unlisted", "v3": "unlisted", "v4": "unlisted"}}
+	service := newFakeService(t, fake)
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+
+	// Each upload makes the one before it private
+	retire := &Retire{Action: "private", Ledger: ledgerPath}
+	for _, id := range []string{"v1", "v2", "v3"} {
+		assert.Nil(t, retirePrevious(service, "winter", id, nil, retire, time.Now()))
+	}
+	assert.Equal(t, map[string]string{"v1": "private", "v2": "private", "v3": "unlisted", "v4": "unlisted"}, fake.privacy)
+
+	// Deleting keeps the newest earlier upload, series are tracked apart
+	retire = &Retire{Action: "delete", Keep: 1, Series: "summer", Ledger: ledgerPath}
+	for _, id := range []string{"v1", "v3", "v4"} {
+		assert.Nil(t, retirePrevious(service, "winter", id, nil, retire, time.Now()))
+	}
+	assert.Equal(t, []string{"v1"}, fake.deleted)
+	entries, err := readLedger(ledgerPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries["winter"]))
+	assert.Equal(t, "private", entries["winter"][0].Retired)
+	assert.Equal(t, "", entries["winter"][2].Retired)
+	assert.Equal(t, []string{"delete", "", ""}, []string{entries["summer"][0].Retired, entries["summer"][1].Retired, entries["summer"][2].Retired})
+	assert.WithinDuration(t, time.Now(), entries["summer"][2].Uploaded, time.Minute)
+
+	// Videos already gone count as retired
+	assert.Nil(t, retirePrevious(service, "gone", "v5", nil, &Retire{Action: "delete", Ledger: ledgerPath}, time.Now()))
+	assert.Nil(t, retirePrevious(service, "gone", "v6", nil, &Retire{Action: "delete", Ledger: ledgerPath}, time.Now()))
+	entries, _ = readLedger(ledgerPath)
+	assert.Equal(t, "delete", entries["gone"][0].Retired)
+}
+
+func TestRetireScheduled(t *testing.T) {
+	fake := &fakeVideoServer{privacy: map[string]string{"v1": "public", "v2": "private", "v3": "public"}}
+	service := newFakeService(t, fake)
+	retire := &Retire{Action: "unlist", Ledger: filepath.Join(t.TempDir(), "ledger.json")}
+	schedule := &Schedule{At: "06:00"}
+	uploadTime := time.Date(2023, 2, 3, 20, 0, 0, 0, time.UTC)
+
+	// The live forecast stays up until the scheduled one is published
+	assert.Nil(t, retirePrevious(service, "winter", "v1", nil, retire, uploadTime))
+	publishAt, scheduled, err := schedule.publishAt(time.Time{}, uploadTime)
+	assert.Nil(t, err)
+	assert.True(t, scheduled)
+	assert.Nil(t, retirePrevious(service, "winter", "v2", &publishAt, retire, uploadTime))
+	assert.Equal(t, "public", fake.privacy["v1"])
+
+	// The next run after the publish time retires both earlier uploads
+	assert.Nil(t, retirePrevious(service, "winter", "v3", nil, retire, publishAt.Add(time.Hour)))
+	assert.Equal(t, "unlisted", fake.privacy["v1"])
+	assert.Equal(t, "unlisted", fake.privacy["v2"])
+	assert.Equal(t, "public", fake.privacy["v3"])
+}
+
+func TestRetireValidate(t *testing.T) {
+	assert.Nil(t, (&Retire{Action: "unlist"}).validate())
+	assert.True(t, strings.Contains((&Retire{Action: "hide"}).validate().Error(), "unsupported action"))
+	assert.NotNil(t, (&Retire{Action: "delete", Keep: -1}).validate())
+
+	// Ledger paths can point at the job's bucket
+	retire := &Retire{Action: "unlist", Ledger: "$AWS_S3_CREDS_BUCKET/youtube-ledger.json"}
+	t.Setenv("AWS_S3_CREDS_BUCKET", "s3://creds/washington")
+	path, err := retire.ledgerPath()
+	assert.Nil(t, err)
+	assert.Equal(t, "s3://creds/washington/youtube-ledger.json", path)
+
+	// Without the bucket the ledger isn't written to the filesystem root
+	t.Setenv("AWS_S3_CREDS_BUCKET", "")
+	_, err = retire.ledgerPath()
+	assert.Contains(t, err.Error(), "unset environment variables AWS_S3_CREDS_BUCKET")
+	assert.NotNil(t, retire.validate())
+}
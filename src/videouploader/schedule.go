@@ -0,0 +1,141 @@
+package videouploader
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	default_schedule_timezone = "UTC"
+	min_publish_lead          = 5 * time.Minute // Closer than this publishes right away
+	scheduled_privacy         = "private"       // YouTube only schedules private videos
+	scheduled_target_privacy  = "public"        // What YouTube makes them at the publish time
+)
+
+// Schedule uploads the video as private and lets YouTube make it public at a
+// time worked out from the rules below, applied in order. Without any rule,
+// or when the time has passed, the video is published right away. Only
+// public videos can be scheduled.
+type Schedule struct {
+	Timezone  string // IANA zone the clock times are in, defaults to UTC
+	InitHours int    // Hours after the forecast cycle init
+	At        string // Next HH:MM on or after the time so far
+	Earliest  string // HH:MM window start, later times move to the next day's start
+	Latest    string // HH:MM window end
+}
+
+// clock is a time of day in minutes after midnight.
+type clock int
+
+func parseClock(value string) (clock, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("schedule: invalid time %q, expected HH:MM", value)
+	}
+	return clock(parsed.Hour()*60 + parsed.Minute()), nil
+}
+
+// on returns the clock time on the day of t.
+func (value clock) on(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, int(value)/60, int(value)%60, 0, 0, t.Location())
+}
+
+func clockOf(t time.Time) clock {
+	return clock(t.Hour()*60 + t.Minute())
+}
+
+func (schedule *Schedule) location() (*time.Location, error) {
+	timezone := schedule.Timezone
+	if timezone == "" {
+		timezone = default_schedule_timezone
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("schedule: %w", err)
+	}
+	return location, nil
+}
+
+func (schedule *Schedule) validate() error {
+	if _, err := schedule.location(); err != nil {
+		return err
+	}
+	if schedule.InitHours < 0 {
+		return fmt.Errorf("schedule: inithours can't be negative")
+	}
+	for _, value := range []string{schedule.At, schedule.Earliest, schedule.Latest} {
+		if value == "" {
+			continue
+		}
+		if _, err := parseClock(value); err != nil {
+			return err
+		}
+	}
+	if (schedule.Earliest == "") != (schedule.Latest == "") {
+		return fmt.Errorf("schedule: window needs both earliest and latest")
+	}
+	return nil
+}
+
+// publishAt returns when the video should go public, and false when it
+// should be published on upload.
+func (schedule *Schedule) publishAt(initTime time.Time, now time.Time) (time.Time, bool, error) {
+	location, err := schedule.location()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	publish := now.In(location)
+
+	// Cycle init offset
+	if schedule.InitHours > 0 {
+		if initTime.IsZero() {
+			return time.Time{}, false, fmt.Errorf("schedule: inithours needs the forecast init time, the video clips have no frame metadata")
+		}
+		if offset := initTime.Add(time.Duration(schedule.InitHours) * time.Hour).In(location); offset.After(publish) {
+			publish = offset
+		}
+	}
+
+	// Next clock time
+	if schedule.At != "" {
+		at, err := parseClock(schedule.At)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		next := at.on(publish)
+		if next.Before(publish) {
+			next = at.on(publish.AddDate(0, 0, 1))
+		}
+		publish = next
+	}
+
+	// Time window, which may wrap past midnight
+	if schedule.Earliest != "" {
+		earliest, err := parseClock(schedule.Earliest)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		latest, err := parseClock(schedule.Latest)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		current := clockOf(publish)
+		inside := earliest <= current && current <= latest
+		if earliest > latest {
+			inside = current >= earliest || current <= latest
+		}
+		if !inside {
+			next := earliest.on(publish)
+			if next.Before(publish) {
+				next = earliest.on(publish.AddDate(0, 0, 1))
+			}
+			publish = next
+		}
+	}
+
+	if publish.Sub(now) < min_publish_lead {
+		return time.Time{}, false, nil
+	}
+	return publish, true, nil
+}
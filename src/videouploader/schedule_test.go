@@ -0,0 +1,55 @@
+package videouploader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishAt(t *testing.T) {
+	initTime := time.Date(2023, 2, 3, 0, 0, 0, 0, time.UTC)
+	utc := func(day int, hour int) time.Time { return time.Date(2023, 2, day, hour, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name      string
+		schedule  Schedule
+		now       time.Time
+		publish   time.Time
+		scheduled bool
+	}{
+		{"no rules", Schedule{}, utc(3, 2), time.Time{}, false},
+		{"init offset", Schedule{InitHours: 30}, utc(3, 2), utc(4, 6), true},
+		{"init offset passed", Schedule{InitHours: 6}, utc(3, 8), time.Time{}, false},
+		{"next local time today", Schedule{Timezone: "America/Los_Angeles", At: "06:00"}, utc(3, 10), utc(3, 14), true},
+		{"next local time tomorrow", Schedule{Timezone: "America/Los_Angeles", At: "06:00"}, utc(3, 15), utc(4, 14), true},
+		{"init offset then local time", Schedule{Timezone: "America/Los_Angeles", InitHours: 24, At: "06:00"}, utc(3, 10), utc(4, 14), true},
+		{"outside window", Schedule{Timezone: "America/Los_Angeles", Earliest: "07:00", Latest: "21:00"}, utc(3, 6), utc(3, 15), true},
+		{"inside window", Schedule{Timezone: "America/Los_Angeles", Earliest: "07:00", Latest: "21:00"}, utc(3, 18), time.Time{}, false},
+		{"window past midnight", Schedule{Earliest: "22:00", Latest: "02:00"}, utc(3, 1), time.Time{}, false},
+		{"outside window past midnight", Schedule{Earliest: "22:00", Latest: "02:00"}, utc(3, 3), utc(3, 22), true},
+	}
+	for _, test := range tests {
+		assert.Nil(t, test.schedule.validate(), test.name)
+		publish, scheduled, err := test.schedule.publishAt(initTime, test.now)
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.scheduled, scheduled, test.name)
+		assert.True(t, test.publish.Equal(publish), "%v: got %v", test.name, publish)
+	}
+
+	// Init offsets need frame metadata
+	_, _, err := (&Schedule{InitHours: 6}).publishAt(time.Time{}, utc(3, 2))
+	assert.NotNil(t, err)
+}
+
+func TestScheduleValidate(t *testing.T) {
+	assert.NotNil(t, (&Schedule{Timezone: "Mars/Olympus"}).validate())
+	assert.NotNil(t, (&Schedule{At: "6am"}).validate())
+	assert.NotNil(t, (&Schedule{Earliest: "07:00"}).validate())
+	assert.NotNil(t, (&Schedule{InitHours: -1}).validate())
+
+	// Scheduled videos always go public
+	schedule := &Schedule{At: "06:00"}
+	assert.Nil(t, (&YoutubeVideo{Privacy: "public", Schedule: schedule}).validate())
+	assert.NotNil(t, (&YoutubeVideo{Privacy: "unlisted", Schedule: schedule}).validate())
+	assert.NotNil(t, (&YoutubeVideo{Schedule: schedule}).validate())
+}
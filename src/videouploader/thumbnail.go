@@ -0,0 +1,65 @@
+package videouploader
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"os"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	max_thumbnail_bytes = 2 * 1024 * 1024
+	min_thumbnail_width = 640
+)
+
+var thumbnail_content_types = []string{"image/jpeg", "image/png"}
+
+// thumbnailPath returns the configured static thumbnail, or the one the
+// build generated.
+func (youtubeVideo *YoutubeVideo) thumbnailPath(generated string) string {
+	if youtubeVideo.Thumbnail != "" {
+		return youtubeVideo.Thumbnail
+	}
+	return generated
+}
+
+// readThumbnail loads the image and checks it against the YouTube limits,
+// returning the data and its content type.
+func readThumbnail(filePath string) ([]byte, string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > max_thumbnail_bytes {
+		return nil, "", fmt.Errorf("thumbnail %v is %v bytes, YouTube allows %v", filePath, len(data), max_thumbnail_bytes)
+	}
+	contentType := http.DetectContentType(data)
+	if !contains(thumbnail_content_types, contentType) {
+		return nil, "", fmt.Errorf("thumbnail %v is %v, YouTube takes jpeg or png", filePath, contentType)
+	}
+
+	// Check the dimensions, YouTube recommends 16:9 at 1280x720
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("thumbnail %v: %w", filePath, err)
+	}
+	if config.Width < min_thumbnail_width {
+		return nil, "", fmt.Errorf("thumbnail %v is %vpx wide, YouTube requires at least %vpx", filePath, config.Width, min_thumbnail_width)
+	}
+	if config.Width*9 != config.Height*16 {
+		log.Printf("Warning: thumbnail %v is %vx%v, YouTube recommends 16:9\n", filePath, config.Width, config.Height)
+	}
+	return data, contentType, nil
+}
+
+func setThumbnail(service *youtube.Service, videoId string, data []byte, contentType string) error {
+	_, err := service.Thumbnails.Set(videoId).Media(bytes.NewReader(data), googleapi.ContentType(contentType)).Do()
+	return err
+}
@@ -0,0 +1,65 @@
+package videouploader
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadThumbnail(t *testing.T) {
+	tempDir := t.TempDir()
+	var encoded bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 1280, 720)), nil))
+	jpegPath := filepath.Join(tempDir, "thumbnail.jpg")
+	assert.Nil(t, os.WriteFile(jpegPath, encoded.Bytes(), 0644))
+
+	data, contentType, err := readThumbnail(jpegPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "image/jpeg", contentType)
+	assert.Equal(t, encoded.Bytes(), data)
+
+	// Too large or not an image
+	largePath := filepath.Join(tempDir, "large.jpg")
+	assert.Nil(t, os.WriteFile(largePath, append(encoded.Bytes(), make([]byte, max_thumbnail_bytes)...), 0644))
+	_, _, err = readThumbnail(largePath)
+	assert.Contains(t, err.Error(), "YouTube allows")
+	textPath := filepath.Join(tempDir, "thumbnail.txt")
+	assert.Nil(t, os.WriteFile(textPath, []byte("not an image"), 0644))
+	_, _, err = readThumbnail(textPath)
+	assert.Contains(t, err.Error(), "jpeg or png")
+
+	// Too narrow
+	var small bytes.Buffer
+	assert.Nil(t, png.Encode(&small, image.NewRGBA(image.Rect(0, 0, 320, 180))))
+	smallPath := filepath.Join(tempDir, "small.png")
+	assert.Nil(t, os.WriteFile(smallPath, small.Bytes(), 0644))
+	_, _, err = readThumbnail(smallPath)
+	assert.Contains(t, err.Error(), "at least 640px")
+
+	// Config overrides the generated thumbnail
+	assert.Equal(t, "static.png", (&YoutubeVideo{Thumbnail: "static.png"}).thumbnailPath("generated.jpg"))
+	assert.Equal(t, "generated.jpg", (&YoutubeVideo{}).thumbnailPath("generated.jpg"))
+}
+
+func TestSetThumbnail(t *testing.T) {
+	var path, videoId, contentType string
+	var body []byte
+	service := newFakeService(t, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		path, videoId, contentType = request.URL.Path, request.URL.Query().Get("videoId"), request.Header.Get("Content-Type")
+		body, _ = io.ReadAll(request.Body)
+		writer.Write([]byte(`{}`))
+	}))
+	assert.Nil(t, setThumbnail(service, "abc123", []byte("png data"), "image/png"))
+	assert.Equal(t, "/upload/youtube/v3/thumbnails/set", path)
+	assert.Equal(t, "abc123", videoId)
+	assert.Contains(t, contentType, "multipart/related")
+	assert.Contains(t, string(body), "Content-Type: image/png\r\n\r\npng data")
+}
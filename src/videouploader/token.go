@@ -0,0 +1,113 @@
+package videouploader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pashonic/arkstorm/src/utils/filestore"
+)
+
+const (
+	token_revoked_code = "invalid_grant"
+)
+
+// TokenStore loads the OAuth token and keeps it current as it is refreshed.
+type TokenStore interface {
+	Load() (*oauth2.Token, error)
+	Save(token *oauth2.Token) error
+}
+
+// fileTokenStore keeps the token in a local file or an S3 object
+// (s3://bucket/key), local files are replaced atomically.
+type fileTokenStore struct {
+	path string
+}
+
+// NewTokenStore returns the store for a local path or s3://bucket/key.
+func NewTokenStore(path string) TokenStore {
+	return &fileTokenStore{path: path}
+}
+
+func (store *fileTokenStore) Load() (*oauth2.Token, error) {
+	data, err := filestore.Read(store.path)
+	if err != nil {
+		return nil, err
+	}
+	token := &oauth2.Token{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("token %v: %w", store.path, err)
+	}
+	return token, nil
+}
+
+func (store *fileTokenStore) Save(token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return filestore.Write(store.path, data, 0600)
+}
+
+// TokenRevokedError is returned when Google refuses to refresh the token,
+// which happens when access was revoked or the refresh token expired.
+type TokenRevokedError struct {
+	Err error
+}
+
+func (err *TokenRevokedError) Error() string {
+	return fmt.Sprintf("youtube token was revoked or has expired, generate a new one with youtube-token-generator: %v", err.Err)
+}
+
+func (err *TokenRevokedError) Unwrap() error {
+	return err.Err
+}
+
+// storingTokenSource saves every token the wrapped source hands out that
+// differs from the last one saved, so rotated refresh tokens aren't lost.
+type storingTokenSource struct {
+	lock    sync.Mutex
+	source  oauth2.TokenSource
+	store   TokenStore
+	saved   *oauth2.Token
+	saveErr error // Last failed save, until a later save succeeds
+}
+
+func newStoringTokenSource(source oauth2.TokenSource, store TokenStore, saved *oauth2.Token) *storingTokenSource {
+	return &storingTokenSource{source: source, store: store, saved: saved}
+}
+
+// saveError returns why the latest refreshed token isn't in the store.
+func (source *storingTokenSource) saveError() error {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	return source.saveErr
+}
+
+func (source *storingTokenSource) Token() (*oauth2.Token, error) {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	token, err := source.source.Token()
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == token_revoked_code {
+			return nil, &TokenRevokedError{Err: err}
+		}
+		return nil, err
+	}
+	if source.saved == nil || token.AccessToken != source.saved.AccessToken || token.RefreshToken != source.saved.RefreshToken {
+		// Keep the request going, the failure is reported with the upload
+		// since a rotated refresh token that isn't saved breaks the next run
+		if err := source.store.Save(token); err != nil {
+			log.Printf("Warning: saving refreshed youtube token failed: %v\n", err)
+			source.saveErr = fmt.Errorf("saving refreshed youtube token failed, the next run may not authorize: %w", err)
+		} else {
+			source.saved, source.saveErr = token, nil
+		}
+	}
+	return token, nil
+}
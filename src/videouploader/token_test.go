@@ -0,0 +1,88 @@
+package videouploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// tokenServer hands out a new access and refresh token on every refresh,
+// or refuses once revoked.
+func tokenServer(t *testing.T, revoked *bool) *oauth2.Config {
+	refreshes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		if *revoked {
+			writer.WriteHeader(http.StatusBadRequest)
+			writer.Write([]byte(`{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`))
+			return
+		}
+		refreshes++
+		fmt.Fprintf(writer, `{"access_token":"access-%v","refresh_token":"refresh-%v","token_type":"Bearer","expires_in":3600}`, refreshes, refreshes)
+	}))
+	t.Cleanup(server.Close)
+	return &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: server.URL}}
+}
+
+type failingTokenStore struct{}
+
+func (store *failingTokenStore) Load() (*oauth2.Token, error) {
+	return nil, errors.New("access denied")
+}
+
+func (store *failingTokenStore) Save(token *oauth2.Token) error {
+	return errors.New("access denied")
+}
+
+func TestStoringTokenSource(t *testing.T) {
+	revoked := false
+	config := tokenServer(t, &revoked)
+	tokenPath := filepath.Join(t.TempDir(), "client_token.json")
+	store := NewTokenStore(tokenPath)
+	expired := &oauth2.Token{AccessToken: "access-0", RefreshToken: "refresh-0", Expiry: time.Now().Add(-time.Hour)}
+	assert.Nil(t, store.Save(expired))
+
+	// The refreshed token replaces the stored one
+	token, err := store.Load()
+	assert.Nil(t, err)
+	source := newStoringTokenSource(config.TokenSource(context.Background(), token), store, token)
+	refreshed, err := source.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "access-1", refreshed.AccessToken)
+	stored, err := store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, "refresh-1", stored.RefreshToken)
+	info, err := os.Stat(tokenPath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Valid tokens aren't saved again
+	assert.Nil(t, os.Remove(tokenPath))
+	_, err = source.Token()
+	assert.Nil(t, err)
+	assert.NoFileExists(t, tokenPath)
+
+	// Failed saves are kept for the upload to report
+	assert.Nil(t, source.saveError())
+	failing := newStoringTokenSource(config.TokenSource(context.Background(), expired), &failingTokenStore{}, expired)
+	_, err = failing.Token()
+	assert.Nil(t, err)
+	assert.Contains(t, failing.saveError().Error(), "access denied")
+
+	// Revoked tokens get a clear error
+	revoked = true
+	source = newStoringTokenSource(config.TokenSource(context.Background(), expired), store, expired)
+	_, err = source.Token()
+	var revokedErr *TokenRevokedError
+	assert.True(t, errors.As(err, &revokedErr))
+	assert.Contains(t, err.Error(), "youtube-token-generator")
+}
@@ -1,19 +1,15 @@
 package videouploader
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"sync"
+	"time"
 
-	"golang.org/x/net/context"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
 
+	"github.com/pashonic/arkstorm/src/publisher"
 	"github.com/pashonic/arkstorm/src/utils/sendsns"
 	"github.com/pashonic/arkstorm/src/videobuilder"
 )
@@ -21,117 +17,217 @@ import (
 const (
 	default_client_secret_file = "client_secret.json"
 	default_client_token_file  = "client_token.json"
+	youtube_destination        = "youtube"
 )
 
 type YoutubeVideos struct {
-	Videos map[string]YoutubeVideo
+	Account                     // Default account, used by videos that don't name one
+	Accounts map[string]Account // Other channels, by name
+	Upload   UploadSettings
+	Videos   map[string]YoutubeVideo
 }
 
 type YoutubeVideo struct {
-	Title       string
-	Description string
+	Account     string // Name of the account to publish with, defaults to the default account
+	Title       string // Title, description and tags are text/template with the upload metadata
+	Description string // Clip chapters are appended unless placed with {{chapters}}
+	Timezone    string // Zone the template times are in, defaults to UTC
 	Privacy     string
 	Tags        []string
 	CategoryId  string
 	SnsAlertArn string
+	PlaylistIds []string // Playlists the video is added to
+	Playlists   []string // Playlist titles, created on the channel when missing
+	Retire      *Retire  // Retires earlier uploads of the series after a new one
+	Schedule    *Schedule
+	Thumbnail   string // Static thumbnail image, defaults to the one the build generated
+	Captions    []Caption
 }
 
-func getTokenFromFile(tokenFilePath string) (*oauth2.Token, error) {
-	file, err := os.Open(tokenFilePath)
-	defer file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
-	token := &oauth2.Token{}
-	if err := json.NewDecoder(file).Decode(token); err != nil {
-		return nil, err
+func (youtubeVideo *YoutubeVideo) validate() error {
+	if youtubeVideo.Retire != nil {
+		if err := youtubeVideo.Retire.validate(); err != nil {
+			return err
+		}
 	}
-	return token, nil
-}
-
-func UploadVideos(youtubeVideos *YoutubeVideos, videos map[string]videobuilder.OutputVideo) error {
-
-	for videoId, youtubeVideo := range youtubeVideos.Videos {
-		video, exists := videos[videoId]
-		if !exists {
-			return errors.New("Generated video ID doesn't exist")
+	if youtubeVideo.Schedule != nil {
+		if err := youtubeVideo.Schedule.validate(); err != nil {
+			return err
 		}
-		if err := upload(video, youtubeVideo); err != nil {
+		// YouTube makes scheduled videos public, whatever the privacy
+		if youtubeVideo.Privacy != scheduled_target_privacy {
+			return fmt.Errorf("schedule: scheduled videos go public at their publish time, privacy must be %q", scheduled_target_privacy)
+		}
+	}
+	// The build subtitles are in a single language, other tracks need their own file
+	buildCaptions := 0
+	for _, caption := range youtubeVideo.Captions {
+		if err := caption.validate(); err != nil {
 			return err
 		}
+		if caption.File == "" {
+			buildCaptions++
+		}
+	}
+	if buildCaptions > 1 {
+		return fmt.Errorf("captions: only one caption can use the build subtitles, set file for the other languages")
 	}
 	return nil
 }
 
-func upload(video videobuilder.OutputVideo, youtubeVideo YoutubeVideo) error {
-	ctx := context.Background()
+type youtubePublisher struct {
+	config  *YoutubeVideos
+	lock    sync.Mutex
+	clients map[string]*accountClient // Authorized clients, by account name
+}
 
-	// Get config using google client config secret file
-	byteData, err := ioutil.ReadFile(default_client_secret_file)
-	if err != nil {
-		return err
+// NewPublisher returns the YouTube destination, uploading videos with the
+// settings configured for their video ID.
+func NewPublisher(config *YoutubeVideos) publisher.Publisher {
+	return &youtubePublisher{config: config, clients: map[string]*accountClient{}}
+}
+
+func (youtubePublisher *youtubePublisher) Name() string {
+	return youtube_destination
+}
+
+func (youtubePublisher *youtubePublisher) Publish(videoId string, video *videobuilder.OutputVideo) publisher.Result {
+	result := publisher.Result{Destination: youtube_destination, VideoId: videoId, Status: publisher.StatusFailed}
+	youtubeVideo, exists := youtubePublisher.config.Videos[videoId]
+	if !exists {
+		result.Err = fmt.Errorf("no youtube settings for video %q", videoId)
+		return result
 	}
-	config, err := google.ConfigFromJSON(byteData, youtube.YoutubeUploadScope)
-	if err != nil {
-		return err
+	if err := youtubeVideo.validate(); err != nil {
+		result.Err = err
+		return result
 	}
-
-	// Get Token file
-	token, err := getTokenFromFile(default_client_token_file)
+	client, err := youtubePublisher.accountClient(youtubeVideo.Account)
 	if err != nil {
-		return err
+		result.Err = err
+		return result
 	}
-
-	// Initialize service
-	service, err := youtube.NewService(ctx, option.WithTokenSource(config.TokenSource(ctx, token)))
+	youtubeId, warnings, err := upload(videoId, *video, youtubeVideo, client, &youtubePublisher.config.Upload)
 	if err != nil {
-		return err
+		result.Err = err
+		return result
 	}
+	result.Id = youtubeId
+	result.Url = "https://youtu.be/" + youtubeId
+	result.Warnings = warnings
+	result.Status = publisher.StatusPublished
+	return result
+}
 
-	description := youtubeVideo.Description + "\n\n"
-	for _, clip := range video.Clips {
-		timeString := fmt.Sprintf(secondsToMinutes(clip.StartTimeSec))
-		description += fmt.Sprintf("%v %v\n", timeString, clip.Name)
+func upload(videoId string, video videobuilder.OutputVideo, youtubeVideo YoutubeVideo, account *accountClient, settings *UploadSettings) (string, []error, error) {
+	// Render the title, description and tags before anything is sent
+	metadata, err := renderMetadata(videoId, &video, &youtubeVideo, time.Now())
+	if err != nil {
+		return "", nil, err
 	}
 
 	// Create upload parameter object
 	upload := &youtube.Video{
 		Snippet: &youtube.VideoSnippet{
-			Title:       youtubeVideo.Title,
-			Description: description,
+			Title:       metadata.Title,
+			Description: metadata.Description,
 			CategoryId:  youtubeVideo.CategoryId,
+			Tags:        metadata.Tags,
 		},
 		Status: &youtube.VideoStatus{PrivacyStatus: youtubeVideo.Privacy},
 	}
-	upload.Snippet.Tags = youtubeVideo.Tags
-	call := service.Videos.Insert([]string{"snippet,status"}, upload)
+
+	// Upload as private and let YouTube publish it on schedule
+	var scheduledAt *time.Time
+	if youtubeVideo.Schedule != nil {
+		publishAt, scheduled, err := youtubeVideo.Schedule.publishAt(video.InitTime, time.Now())
+		if err != nil {
+			return "", nil, err
+		}
+		if scheduled {
+			log.Printf("Scheduling %q to publish at %v\n", metadata.Title, publishAt.Format(time.RFC1123))
+			upload.Status.PrivacyStatus = scheduled_privacy
+			upload.Status.PublishAt = publishAt.UTC().Format(time.RFC3339)
+			scheduledAt = &publishAt
+		}
+	}
 
 	// Open video file
 	file, err := os.Open(video.FilePath)
+	if err != nil {
+		return "", nil, err
+	}
 	defer file.Close()
+	fileInfo, err := file.Stat()
 	if err != nil {
-		return err
+		return "", nil, err
+	}
+
+	// Check the thumbnail before spending the upload on it, YouTube falls
+	// back to a frame of the video so problems are only warnings
+	var warnings []error
+	var thumbnailData []byte
+	var thumbnailType string
+	if thumbnailPath := youtubeVideo.thumbnailPath(video.ThumbnailPath); thumbnailPath != "" {
+		if thumbnailData, thumbnailType, err = readThumbnail(thumbnailPath); err != nil {
+			warnings = append(warnings, fmt.Errorf("keeping the default thumbnail: %w", err))
+		}
 	}
 
 	// Upload video
-	response, err := call.Media(file).Do()
+	response, err := newResumableUploader(account.client, settings).upload(upload, file, fileInfo.Size())
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 	log.Printf("Upload successful! Video ID: %v\n", response.Id)
 
-	// Send SNS alert
-	youtubeLink := "https://youtu.be/" + response.Id
+	// The video is live from here on, later steps only warn so a rerun
+	// doesn't upload it again
+	service := account.service
+	if thumbnailData != nil {
+		if err := setThumbnail(service, response.Id, thumbnailData, thumbnailType); err != nil {
+			warnings = append(warnings, fmt.Errorf("keeping the default thumbnail: %w", err))
+		}
+	}
+	if len(youtubeVideo.Captions) > 0 {
+		if err := insertCaptions(service, response.Id, youtubeVideo.Captions, video.Subtitles); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+	if len(youtubeVideo.PlaylistIds) > 0 || len(youtubeVideo.Playlists) > 0 {
+		if err := addToPlaylists(service, response.Id, &youtubeVideo); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+	if youtubeVideo.Retire != nil {
+		if err := retirePrevious(service, videoId, response.Id, scheduledAt, youtubeVideo.Retire, time.Now()); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	if err := account.tokens.saveError(); err != nil {
+		warnings = append(warnings, err)
+	}
+
+	// Send SNS alert, listing anything that needs a look
+	message := "https://youtu.be/" + response.Id
+	if len(warnings) > 0 {
+		message += "\n\nWarnings:"
+		for _, warning := range warnings {
+			message += "\n- " + warning.Error()
+		}
+	}
 	if youtubeVideo.SnsAlertArn != "" {
-		if err := sendsns.SendSNS(youtubeVideo.Title+" Uploaded", youtubeLink, youtubeVideo.SnsAlertArn); err != nil {
-			return err
+		if err := sendsns.SendSNS(metadata.Title+" Uploaded", message, youtubeVideo.SnsAlertArn); err != nil {
+			warnings = append(warnings, fmt.Errorf("sns alert: %w", err))
 		}
 	}
-	return nil
+	return response.Id, warnings, nil
 }
 
-func secondsToMinutes(inSeconds int) string {
-	minutes := inSeconds / 60
-	seconds := inSeconds % 60
+func secondsToMinutes(inSeconds float64) string {
+	totalSeconds := int(inSeconds) // YouTube chapters only resolve whole seconds
+	minutes := totalSeconds / 60
+	seconds := totalSeconds % 60
 	return fmt.Sprintf("%v:%02d", minutes, seconds)
 }
@@ -27,7 +27,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	config, err := google.ConfigFromJSON(byteData, youtube.YoutubeUploadScope)
+	config, err := google.ConfigFromJSON(byteData, youtube.YoutubeUploadScope, youtube.YoutubeScope, youtube.YoutubeForceSslScope)
 	if err != nil {
 		log.Fatal(err)
 	}